@@ -25,6 +25,7 @@ import (
 	"github.com/santhosh-tekuri/jsonschema/v5"
 	"github.com/sirupsen/logrus"
 	"github.com/zhchang/goquiver/safe"
+	"gopkg.in/yaml.v3"
 )
 
 var loaderCache = safe.NewMap[string, *sync.Once]()
@@ -69,6 +70,7 @@ func removeEmptyRequired(obj map[string]interface{}) {
 // localPath: The local file path where the asset is stored.
 // url: The URL where the asset can be accessed.
 // schema: The JSON schema associated with the asset, used for validation.
+// metadata: The rollout settings of the asset, read from its optional metadata.yaml.
 type Asset struct {
 	id        string
 	typ       string
@@ -76,6 +78,15 @@ type Asset struct {
 	localPath string
 	url       string
 	schema    *jsonschema.Schema
+	metadata  *Metadata
+}
+
+// Metadata holds the rollout settings an asset ships in its optional metadata.yaml.
+//
+// Fields:
+// Rotation: The StatefulSet rotation policy of the asset's chart, unset fields keep their default.
+type Metadata struct {
+	Rotation *global.RotationPolicy `yaml:"rotation"`
 }
 
 // New creates a new Asset instance with the specified asset context, type, and release.
@@ -164,10 +175,41 @@ func New(rc global.AssetContext, typ, release string) (*Asset, error) {
 	if a.schema, err = compiler.Compile("file://" + filepath.ToSlash(absPath)); err != nil {
 		return nil, err
 	}
+	if a.metadata, err = readMetadata(a.localPath + "/metadata.yaml"); err != nil {
+		return nil, err
+	}
 
 	return a, nil
 }
 
+func readMetadata(path string) (*Metadata, error) {
+	metadata := &Metadata{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return metadata, nil
+		}
+		return nil, err
+	}
+	if err = yaml.Unmarshal(data, metadata); err != nil {
+		return nil, fmt.Errorf("invalid asset metadata %s: %w", path, err)
+	}
+	if metadata.Rotation != nil {
+		if err = metadata.Rotation.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return metadata, nil
+}
+
+// Metadata returns the rollout settings of the asset.
+func (a *Asset) Metadata() *Metadata {
+	if a.metadata == nil {
+		return &Metadata{}
+	}
+	return a.metadata
+}
+
 // Validate validates the given values against the asset's schema.
 // It returns an error if the schema is not initialized or if the validation fails.
 func (a *Asset) Validate(values map[string]any) error {
@@ -0,0 +1,277 @@
+// Package controller provides a Kubernetes controller for the GoremanResource custom resource.
+// It watches GoremanResource objects and continuously converges the cluster towards them using
+// "github.com/nextbillion-ai/goreman-util/resource": every object is rolled out with Resource.Rollout,
+// its progress is recorded in status conditions, and it is uninstalled through a finalizer when deleted.
+//
+// The global options must be initialized (global.Init or global.InitFromConfigMap) before running the controller.
+package controller
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/nextbillion-ai/goreman-util/global"
+	"github.com/nextbillion-ai/goreman-util/internal/kube"
+	"github.com/nextbillion-ai/goreman-util/resource"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	Group     = "goreman.nextbillion.ai"
+	Version   = "v1"
+	Kind      = "GoremanResource"
+	Finalizer = "goreman.nextbillion.ai/uninstall"
+
+	// ConditionReady is the status condition reporting the outcome of the last rollout.
+	ConditionReady = "Ready"
+)
+
+// GVR is the group/version/resource of GoremanResource.
+var GVR = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "goremanresources"}
+
+//go:embed crd.yaml
+var crdYaml string
+
+// CRD returns the CustomResourceDefinition manifest for GoremanResource.
+func CRD() string {
+	return crdYaml
+}
+
+// GoremanResource declares a goreman resource: the asset to deploy and its app values.
+// The name and namespace of the object are the name and namespace of the deployed resource.
+type GoremanResource struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              global.Spec           `json:"spec"`
+	Status            GoremanResourceStatus `json:"status,omitempty"`
+}
+
+// GoremanResourceStatus is the observed state of a GoremanResource.
+type GoremanResourceStatus struct {
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	LastRolloutTime    *metav1.Time       `json:"lastRolloutTime,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+}
+
+var dynamicClient = kube.Dynamic
+
+var rollout = func(rc global.ResourceContext, name string, spec *global.Spec, options ...resource.ResourceOption) error {
+	r, err := resource.New(rc, name, spec)
+	if err != nil {
+		return err
+	}
+	return r.Rollout(rc, options...)
+}
+
+var uninstall = func(rc global.ResourceContext, name string, options ...resource.ResourceOption) error {
+	return resource.Uninstall(rc, name, options...)
+}
+
+type controllerOptions struct {
+	namespace       string
+	resync          time.Duration
+	workers         int
+	contextOptions  []global.ContextOption
+	resourceOptions []resource.ResourceOption
+}
+
+type Option func(*controllerOptions)
+
+// WithNamespace restricts the controller to one namespace. All namespaces are watched by default.
+func WithNamespace(namespace string) Option {
+	return func(opts *controllerOptions) {
+		opts.namespace = namespace
+	}
+}
+
+// WithResync sets how often every GoremanResource is rolled out again even if it did not change.
+func WithResync(d time.Duration) Option {
+	return func(opts *controllerOptions) {
+		opts.resync = d
+	}
+}
+
+// WithWorkers sets the number of GoremanResources reconciled concurrently.
+func WithWorkers(workers int) Option {
+	return func(opts *controllerOptions) {
+		opts.workers = workers
+	}
+}
+
+// WithContextOptions sets the options used to build the ResourceContext of every reconciliation.
+// The namespace is always the namespace of the GoremanResource.
+func WithContextOptions(options ...global.ContextOption) Option {
+	return func(opts *controllerOptions) {
+		opts.contextOptions = options
+	}
+}
+
+// WithResourceOptions sets the options passed to Rollout and Uninstall.
+func WithResourceOptions(options ...resource.ResourceOption) Option {
+	return func(opts *controllerOptions) {
+		opts.resourceOptions = options
+	}
+}
+
+// Controller reconciles GoremanResource objects.
+type Controller struct {
+	opts *controllerOptions
+}
+
+// New creates a Controller. By default it watches all namespaces with one worker and a 10 minutes resync.
+func New(options ...Option) *Controller {
+	opts := &controllerOptions{
+		resync:  10 * time.Minute,
+		workers: 1,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+	return &Controller{opts: opts}
+}
+
+// Run watches GoremanResources and reconciles them until ctx is done.
+func (c *Controller) Run(ctx context.Context) error {
+	client, err := dynamicClient()
+	if err != nil {
+		return err
+	}
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, c.opts.resync, c.opts.namespace, nil)
+	informer := factory.ForResource(GVR).Informer()
+	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer queue.ShutDown()
+	enqueue := func(obj any) {
+		if key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err == nil {
+			queue.Add(key)
+		}
+	}
+	if _, err = informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: enqueue,
+		UpdateFunc: func(oldObj, newObj any) {
+			o, ok1 := oldObj.(*unstructured.Unstructured)
+			n, ok2 := newObj.(*unstructured.Unstructured)
+			// status updates do not need a new rollout, only resyncs, spec changes and deletions do
+			if ok1 && ok2 && o.GetResourceVersion() != n.GetResourceVersion() &&
+				o.GetGeneration() == n.GetGeneration() && n.GetDeletionTimestamp() == nil {
+				return
+			}
+			enqueue(newObj)
+		},
+	}); err != nil {
+		return err
+	}
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return fmt.Errorf("failed to sync %s cache", GVR.Resource)
+	}
+	for i := 0; i < max(c.opts.workers, 1); i++ {
+		go c.work(ctx, queue)
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func (c *Controller) work(ctx context.Context, queue workqueue.RateLimitingInterface) {
+	for {
+		item, shutdown := queue.Get()
+		if shutdown {
+			return
+		}
+		key := item.(string)
+		namespace, name, err := cache.SplitMetaNamespaceKey(key)
+		if err == nil {
+			err = c.Reconcile(ctx, namespace, name)
+		}
+		if err != nil {
+			logrus.Warnf("failed to reconcile %s %s: %s", Kind, key, err)
+			queue.AddRateLimited(key)
+		} else {
+			queue.Forget(key)
+		}
+		queue.Done(key)
+	}
+}
+
+// Reconcile converges one GoremanResource: it rolls the resource out and records the outcome in
+// its status, or uninstalls it and releases the finalizer when the object is being deleted.
+// An error is returned when the reconciliation should be retried.
+func (c *Controller) Reconcile(ctx context.Context, namespace, name string) error {
+	client, err := dynamicClient()
+	if err != nil {
+		return err
+	}
+	ri := client.Resource(GVR).Namespace(namespace)
+	var obj *unstructured.Unstructured
+	if obj, err = ri.Get(ctx, name, metav1.GetOptions{}); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	rc := global.NewContext(ctx, append(slices.Clone(c.opts.contextOptions), global.WithNamespace(namespace))...)
+
+	finalizers := obj.GetFinalizers()
+	if obj.GetDeletionTimestamp() != nil {
+		if !slices.Contains(finalizers, Finalizer) {
+			return nil
+		}
+		if err = uninstall(rc, name, c.opts.resourceOptions...); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		obj.SetFinalizers(slices.DeleteFunc(finalizers, func(f string) bool { return f == Finalizer }))
+		_, err = ri.Update(ctx, obj, metav1.UpdateOptions{})
+		return err
+	}
+	if !slices.Contains(finalizers, Finalizer) {
+		obj.SetFinalizers(append(finalizers, Finalizer))
+		if obj, err = ri.Update(ctx, obj, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+	}
+
+	var status GoremanResourceStatus
+	if raw, ok := obj.Object["status"].(map[string]any); ok {
+		if err = runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &status); err != nil {
+			return err
+		}
+	}
+	status.ObservedGeneration = obj.GetGeneration()
+	condition := metav1.Condition{
+		Type:               ConditionReady,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: obj.GetGeneration(),
+		Reason:             "RolloutSucceeded",
+		Message:            "rollout succeeded",
+	}
+	var spec *global.Spec
+	var rolloutErr error
+	if spec, err = global.SpecFromJSON(obj.Object["spec"], global.WithStrict()); err != nil {
+		// an invalid spec is not retried, the object has to be fixed first
+		condition.Status, condition.Reason, condition.Message = metav1.ConditionFalse, "InvalidSpec", err.Error()
+	} else if rolloutErr = rollout(rc, name, spec, c.opts.resourceOptions...); rolloutErr != nil {
+		condition.Status, condition.Reason, condition.Message = metav1.ConditionFalse, "RolloutFailed", rolloutErr.Error()
+	} else {
+		now := metav1.Now()
+		status.LastRolloutTime = &now
+	}
+	meta.SetStatusCondition(&status.Conditions, condition)
+	if obj.Object["status"], err = runtime.DefaultUnstructuredConverter.ToUnstructured(&status); err != nil {
+		return err
+	}
+	if _, err = ri.UpdateStatus(ctx, obj, metav1.UpdateOptions{}); err != nil {
+		return err
+	}
+	return rolloutErr
+}
@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/nextbillion-ai/goreman-util/global"
+	"github.com/nextbillion-ai/goreman-util/operation"
+	"github.com/nextbillion-ai/goreman-util/resource"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func newGoremanResource(spec map[string]any) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": Group + "/" + Version,
+		"kind":       Kind,
+		"metadata": map[string]any{
+			"name":       "api",
+			"namespace":  "ns",
+			"generation": int64(3),
+		},
+		"spec": spec,
+	}}
+	return obj
+}
+
+func setupControllerTest(t *testing.T, obj *unstructured.Unstructured) (dynamic.Interface, func()) {
+	dynamicClientOrg := dynamicClient
+	rolloutOrg := rollout
+	uninstallOrg := uninstall
+	client := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{GVR: Kind + "List"}, obj)
+	dynamicClient = func() (dynamic.Interface, error) { return client, nil }
+	return client, func() {
+		dynamicClient = dynamicClientOrg
+		rollout = rolloutOrg
+		uninstall = uninstallOrg
+	}
+}
+
+func getStatus(t *testing.T, client dynamic.Interface) (*unstructured.Unstructured, GoremanResourceStatus) {
+	obj, err := client.Resource(GVR).Namespace("ns").Get(context.Background(), "api", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status GoremanResourceStatus
+	if raw, ok := obj.Object["status"].(map[string]any); ok {
+		if err = runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &status); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return obj, status
+}
+
+func TestReconcile(t *testing.T) {
+	client, teardown := setupControllerTest(t, newGoremanResource(map[string]any{
+		"asset": map[string]any{"type": "service", "release": "v1"},
+		"app":   map[string]any{"replicas": int64(2)},
+	}))
+	defer teardown()
+	var rolledOut *global.Spec
+	rollout = func(rc global.ResourceContext, name string, spec *global.Spec, options ...resource.ResourceOption) error {
+		assert.Equal(t, "api", name)
+		assert.Equal(t, "ns", rc.Namespace())
+		rolledOut = spec
+		return nil
+	}
+	assert.NoError(t, New().Reconcile(context.Background(), "ns", "api"))
+	assert.Equal(t, "v1", rolledOut.Asset.Release)
+
+	obj, status := getStatus(t, client)
+	assert.Contains(t, obj.GetFinalizers(), Finalizer)
+	assert.Equal(t, int64(3), status.ObservedGeneration)
+	assert.NotNil(t, status.LastRolloutTime)
+	assert.True(t, meta.IsStatusConditionTrue(status.Conditions, ConditionReady))
+
+	rollout = func(rc global.ResourceContext, name string, spec *global.Spec, options ...resource.ResourceOption) error {
+		return fmt.Errorf("boom")
+	}
+	assert.Error(t, New().Reconcile(context.Background(), "ns", "api"))
+	_, status = getStatus(t, client)
+	condition := meta.FindStatusCondition(status.Conditions, ConditionReady)
+	assert.Equal(t, metav1.ConditionFalse, condition.Status)
+	assert.Equal(t, "RolloutFailed", condition.Reason)
+}
+
+func TestReconcileInvalidSpec(t *testing.T) {
+	client, teardown := setupControllerTest(t, newGoremanResource(map[string]any{
+		"asset": map[string]any{"type": "service"},
+	}))
+	defer teardown()
+	rollout = func(rc global.ResourceContext, name string, spec *global.Spec, options ...resource.ResourceOption) error {
+		t.Fatal("rollout should not be called for an invalid spec")
+		return nil
+	}
+	assert.NoError(t, New().Reconcile(context.Background(), "ns", "api"))
+	_, status := getStatus(t, client)
+	condition := meta.FindStatusCondition(status.Conditions, ConditionReady)
+	assert.Equal(t, "InvalidSpec", condition.Reason)
+}
+
+func TestReconcileDeletion(t *testing.T) {
+	obj := newGoremanResource(map[string]any{
+		"asset": map[string]any{"type": "service", "release": "v1"},
+	})
+	now := metav1.Now()
+	obj.SetDeletionTimestamp(&now)
+	obj.SetFinalizers([]string{Finalizer, "other"})
+	client, teardown := setupControllerTest(t, obj)
+	defer teardown()
+	var uninstalled string
+	uninstall = func(rc global.ResourceContext, name string, options ...resource.ResourceOption) error {
+		uninstalled = name
+		return &operation.RemovalError{Failed: []operation.Removal{{Kind: "Service", Name: "api", Namespace: "ns", Err: errors.New("forbidden")}}}
+	}
+	assert.ErrorContains(t, New().Reconcile(context.Background(), "ns", "api"), "forbidden")
+	assert.Equal(t, "api", uninstalled)
+	obj, _ = getStatus(t, client)
+	assert.Equal(t, []string{Finalizer, "other"}, obj.GetFinalizers())
+
+	uninstall = func(rc global.ResourceContext, name string, options ...resource.ResourceOption) error {
+		return nil
+	}
+	assert.NoError(t, New().Reconcile(context.Background(), "ns", "api"))
+	obj, _ = getStatus(t, client)
+	assert.Equal(t, []string{"other"}, obj.GetFinalizers())
+}
+
+func TestCRD(t *testing.T) {
+	assert.Contains(t, CRD(), "goremanresources."+Group)
+}
@@ -29,7 +29,40 @@ type Spec struct {
 	App map[string]any `yaml:"app" json:"app"`
 }
 
-func SpecFromJSON(input any) (*Spec, error) {
+// DeepCopy returns a copy of s that shares no map or slice with it.
+func (s *Spec) DeepCopy() *Spec {
+	if s == nil {
+		return nil
+	}
+	c := *s
+	if s.App != nil {
+		c.App = deepCopyValue(s.App).(map[string]any)
+	}
+	return &c
+}
+
+func deepCopyValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(v))
+		for key, item := range v {
+			c[key] = deepCopyValue(item)
+		}
+		return c
+	case []any:
+		c := make([]any, len(v))
+		for i, item := range v {
+			c[i] = deepCopyValue(item)
+		}
+		return c
+	default:
+		return value
+	}
+}
+
+// SpecFromJSON parses a Spec from JSON. The input can be a byte slice, a file path, an io.ReadCloser
+// or any value that can be marshaled to JSON. Unknown fields are ignored unless WithStrict is given.
+func SpecFromJSON(input any, options ...SpecOption) (*Spec, error) {
 	var err error
 	var data []byte
 	switch v := input.(type) {
@@ -49,6 +82,9 @@ func SpecFromJSON(input any) (*Spec, error) {
 			return nil, err
 		}
 	}
+	if newSpecOptions(options...).strict {
+		return strictSpecFromJSON(data)
+	}
 	var spec Spec
 	if err = json.Unmarshal(data, &spec); err != nil {
 		return nil, err
@@ -56,7 +92,9 @@ func SpecFromJSON(input any) (*Spec, error) {
 	return &spec, nil
 }
 
-func SpecFromYaml(input any) (*Spec, error) {
+// SpecFromYaml parses a Spec from YAML. The input can be a byte slice, a file path or an io.ReadCloser.
+// Unknown fields are ignored unless WithStrict is given.
+func SpecFromYaml(input any, options ...SpecOption) (*Spec, error) {
 	var err error
 	var data []byte
 	switch v := input.(type) {
@@ -74,6 +112,9 @@ func SpecFromYaml(input any) (*Spec, error) {
 	default:
 		return nil, fmt.Errorf("unsupported input type: %s", v)
 	}
+	if newSpecOptions(options...).strict {
+		return strictSpecFromYaml(data)
+	}
 
 	var spec Spec
 	if err = yaml.Unmarshal(data, &spec); err != nil {
@@ -118,6 +159,8 @@ type rcImpl struct {
 	timeout   time.Duration
 	logger    *logrus.Logger
 	plugins   []*Plugin
+
+	rotationPolicy *RotationPolicy
 }
 
 // Context implements ResourceContext.
@@ -148,6 +191,14 @@ func (r *rcImpl) Plugins() []*Plugin {
 	return r.plugins
 }
 
+// RotationPolicy returns the StatefulSet rotation policy of the context, see RotationPolicyOf.
+func (r *rcImpl) RotationPolicy() *RotationPolicy {
+	if r.rotationPolicy == nil {
+		return DefaultRotationPolicy()
+	}
+	return r.rotationPolicy
+}
+
 type ContextOption func(*rcImpl)
 
 func WithNamespace(namespace string) ContextOption {
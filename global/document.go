@@ -0,0 +1,175 @@
+package global
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// SpecDocument is a YAML spec kept as a yaml.v3 node tree, so that it can be edited
+// programmatically and written back with its key order and comments untouched.
+type SpecDocument struct {
+	doc yaml.Node
+}
+
+// SpecDocumentFromYaml parses a YAML spec into a SpecDocument.
+// The input can be a byte slice, a file path or an io.ReadCloser.
+func SpecDocumentFromYaml(input any) (*SpecDocument, error) {
+	var err error
+	var data []byte
+	if data, err = readYamlInput(input); err != nil {
+		return nil, err
+	}
+	d := &SpecDocument{}
+	if err = yaml.Unmarshal(data, &d.doc); err != nil {
+		return nil, err
+	}
+	if d.doc.Kind == 0 {
+		d.doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	if d.doc.Kind != yaml.DocumentNode || len(d.doc.Content) == 0 || d.doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("spec must be a mapping")
+	}
+	return d, nil
+}
+
+// Spec decodes the document into a Spec.
+func (d *SpecDocument) Spec() (*Spec, error) {
+	var spec Spec
+	if err := d.doc.Decode(&spec); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// SetAssetRelease sets asset.release, creating the asset section if needed.
+func (d *SpecDocument) SetAssetRelease(release string) error {
+	return d.set([]string{"asset", "release"}, release)
+}
+
+// SetAppValue sets the app value found at path, a dot separated list of keys where
+// numeric segments index sequences (e.g. `containers.0.image`). Missing mappings are created.
+func (d *SpecDocument) SetAppValue(path string, value any) error {
+	if path == "" {
+		return fmt.Errorf("empty path")
+	}
+	return d.set(append([]string{"app"}, strings.Split(path, ".")...), value)
+}
+
+func (d *SpecDocument) set(keys []string, value any) error {
+	var node yaml.Node
+	if err := node.Encode(value); err != nil {
+		return err
+	}
+	running := d.doc.Content[0]
+	for index, key := range keys {
+		last := index == len(keys)-1
+		switch running.Kind {
+		case yaml.MappingNode:
+			var child *yaml.Node
+			for i := 0; i+1 < len(running.Content); i += 2 {
+				if running.Content[i].Value == key {
+					child = running.Content[i+1]
+					break
+				}
+			}
+			if child == nil {
+				child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+				running.Content = append(running.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, child)
+			}
+			if last {
+				replaceNode(child, &node)
+				return nil
+			}
+			if child.Kind == yaml.ScalarNode && child.Tag == "!!null" {
+				child.Kind, child.Tag, child.Value = yaml.MappingNode, "!!map", ""
+			}
+			running = child
+		case yaml.SequenceNode:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(running.Content) {
+				return fmt.Errorf("invalid index %s at %s", key, strings.Join(keys[:index], "."))
+			}
+			if last {
+				replaceNode(running.Content[i], &node)
+				return nil
+			}
+			running = running.Content[i]
+		default:
+			return fmt.Errorf("%s is not a mapping or sequence", strings.Join(keys[:index], "."))
+		}
+	}
+	return nil
+}
+
+// replaceNode overwrites target with value while keeping the comments attached to target.
+func replaceNode(target, value *yaml.Node) {
+	head, line, foot := target.HeadComment, target.LineComment, target.FootComment
+	*target = *value
+	target.HeadComment, target.LineComment, target.FootComment = head, line, foot
+}
+
+// SpecToYaml serializes a *Spec or a *SpecDocument to YAML with a two space indentation.
+// A SpecDocument keeps its key order and comments, a Spec is written in canonical form.
+func SpecToYaml(input any) ([]byte, error) {
+	var value any
+	switch v := input.(type) {
+	case *SpecDocument:
+		value = &v.doc
+	case *Spec:
+		value = v
+	default:
+		return nil, fmt.Errorf("unsupported input type: %T", v)
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(value); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SpecToJSON serializes a *Spec or a *SpecDocument to indented JSON.
+func SpecToJSON(input any) ([]byte, error) {
+	var err error
+	var spec *Spec
+	switch v := input.(type) {
+	case *SpecDocument:
+		if spec, err = v.Spec(); err != nil {
+			return nil, err
+		}
+	case *Spec:
+		spec = v
+	default:
+		return nil, fmt.Errorf("unsupported input type: %T", v)
+	}
+	var data []byte
+	if data, err = json.MarshalIndent(spec, "", "  "); err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func readYamlInput(input any) ([]byte, error) {
+	switch v := input.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return os.ReadFile(v)
+	case io.ReadCloser:
+		defer v.Close()
+		return io.ReadAll(v)
+	default:
+		return nil, fmt.Errorf("unsupported input type: %s", v)
+	}
+}
@@ -0,0 +1,71 @@
+package global
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var documentYaml = `# service spec
+asset:
+  type: service
+  release: v1 # bumped by automation
+app:
+  replicas: 2
+  containers:
+    - image: api:1
+  env:
+    LOG: info
+`
+
+func TestSpecDocument(t *testing.T) {
+	d, err := SpecDocumentFromYaml([]byte(documentYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, d.SetAssetRelease("v2"))
+	assert.NoError(t, d.SetAppValue("replicas", 3))
+	assert.NoError(t, d.SetAppValue("containers.0.image", "api:2"))
+	assert.NoError(t, d.SetAppValue("resources.cpu", "500m"))
+	assert.Error(t, d.SetAppValue("containers.1.image", "api:2"))
+	assert.Error(t, d.SetAppValue("replicas.max", 1))
+
+	data, err := SpecToYaml(d)
+	assert.NoError(t, err)
+	assert.Equal(t, `# service spec
+asset:
+  type: service
+  release: v2 # bumped by automation
+app:
+  replicas: 3
+  containers:
+    - image: api:2
+  env:
+    LOG: info
+  resources:
+    cpu: 500m
+`, string(data))
+
+	spec, err := d.Spec()
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", spec.Asset.Release)
+	assert.Equal(t, 3, spec.App["replicas"])
+}
+
+func TestSpecToYamlAndJSON(t *testing.T) {
+	spec := &Spec{App: map[string]any{"b": 1, "a": "x"}}
+	spec.Asset.Typ = "service"
+	spec.Asset.Release = "v1"
+
+	data, err := SpecToYaml(spec)
+	assert.NoError(t, err)
+	assert.Equal(t, "asset:\n  type: service\n  release: v1\napp:\n  a: x\n  b: 1\n", string(data))
+
+	data, err = SpecToJSON(spec)
+	assert.NoError(t, err)
+	assert.Equal(t, "{\n  \"asset\": {\n    \"type\": \"service\",\n    \"release\": \"v1\"\n  },\n  \"app\": {\n    \"a\": \"x\",\n    \"b\": 1\n  }\n}\n", string(data))
+
+	parsed, err := SpecFromYaml(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", parsed.Asset.Release)
+}
@@ -0,0 +1,158 @@
+package global
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nextbillion-ai/goreman-util/internal/kube"
+	"github.com/nextbillion-ai/gsg/lib/object"
+	"github.com/zhchang/goquiver/k8s"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// DefaultSpecKey is the ConfigMap key SpecFromConfigMap reads when no key is given.
+const DefaultSpecKey = "spec.yaml"
+
+var readUrl = func(ctx context.Context, url string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(url, "http://"), strings.HasPrefix(url, "https://"):
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to fetch %s: %s", url, resp.Status)
+		}
+		return io.ReadAll(resp.Body)
+	default:
+		o, err := object.New(url)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err = o.Read(&buf); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+}
+
+var getConfigMap = func(ctx context.Context, name, namespace string) (*k8s.ConfigMap, error) {
+	return k8s.Get[*k8s.ConfigMap](ctx, name, namespace)
+}
+
+var getCustomResource = func(ctx context.Context, gvr schema.GroupVersionResource, name, namespace string) (*unstructured.Unstructured, error) {
+	client, err := kube.Dynamic()
+	if err != nil {
+		return nil, err
+	}
+	return client.Resource(gvr).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+func specFromData(data []byte, path string, options ...SpecOption) (*Spec, error) {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return SpecFromJSON(data, options...)
+	}
+	return SpecFromYaml(data, options...)
+}
+
+// SpecFromUrl loads a spec from a storage URL (gs://, s3://) or an http(s) URL.
+// Specs whose URL ends with .json are parsed as JSON, anything else as YAML.
+func SpecFromUrl(ctx context.Context, url string, options ...SpecOption) (*Spec, error) {
+	data, err := readUrl(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return specFromData(data, url, options...)
+}
+
+// SpecFromConfigMap loads a spec stored under key in a ConfigMap.
+// An empty key defaults to DefaultSpecKey; keys ending with .json are parsed as JSON.
+func SpecFromConfigMap(ctx context.Context, name, namespace, key string, options ...SpecOption) (*Spec, error) {
+	if key == "" {
+		key = DefaultSpecKey
+	}
+	cfg, err := getConfigMap(ctx, name, namespace)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := cfg.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("key %s not found in configmap %s/%s", key, namespace, name)
+	}
+	return specFromData([]byte(data), key, options...)
+}
+
+// SpecFromCustomResource loads a spec from the `spec` field of a custom resource, which
+// must have the Spec shape (`asset` and `app`).
+func SpecFromCustomResource(ctx context.Context, gvr schema.GroupVersionResource, name, namespace string, options ...SpecOption) (*Spec, error) {
+	obj, err := getCustomResource(ctx, gvr, name, namespace)
+	if err != nil {
+		return nil, err
+	}
+	spec, ok, err := unstructured.NestedMap(obj.Object, "spec")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%s %s/%s has no spec", gvr.Resource, namespace, name)
+	}
+	return SpecFromJSON(spec, options...)
+}
+
+// SpecsFromDir loads every spec (.yaml, .yml or .json file) found under root, skipping hidden
+// files and directories. The specs are keyed by their path relative to root, without extension
+// and with forward slashes, e.g. `team/api` for `root/team/api.yaml`.
+func SpecsFromDir(root string, options ...SpecOption) (map[string]*Spec, error) {
+	specs := map[string]*Spec{}
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if ext != ".yaml" && ext != ".yml" && ext != ".json" {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		spec, err := specFromData(data, path, options...)
+		if err != nil {
+			return fmt.Errorf("failed to load %s: %w", path, err)
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		specs[filepath.ToSlash(strings.TrimSuffix(rel, filepath.Ext(rel)))] = spec
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return specs, nil
+}
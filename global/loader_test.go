@@ -0,0 +1,94 @@
+package global
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhchang/goquiver/k8s"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func setupLoaderTest(t *testing.T) func() {
+	readUrlOrg := readUrl
+	getConfigMapOrg := getConfigMap
+	getCustomResourceOrg := getCustomResource
+	return func() {
+		readUrl = readUrlOrg
+		getConfigMap = getConfigMapOrg
+		getCustomResource = getCustomResourceOrg
+	}
+}
+
+func TestSpecFromUrl(t *testing.T) {
+	defer setupLoaderTest(t)()
+	files := map[string]string{
+		"gs://bucket/api.yaml":         "asset: {type: t, release: r1}\n",
+		"https://example.com/api.json": `{"asset":{"type":"t","release":"r2"}}`,
+	}
+	readUrl = func(ctx context.Context, url string) ([]byte, error) {
+		return []byte(files[url]), nil
+	}
+	spec, err := SpecFromUrl(context.Background(), "gs://bucket/api.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, "r1", spec.Asset.Release)
+	spec, err = SpecFromUrl(context.Background(), "https://example.com/api.json")
+	assert.NoError(t, err)
+	assert.Equal(t, "r2", spec.Asset.Release)
+}
+
+func TestSpecFromConfigMap(t *testing.T) {
+	defer setupLoaderTest(t)()
+	getConfigMap = func(ctx context.Context, name, namespace string) (*k8s.ConfigMap, error) {
+		cfg := &k8s.ConfigMap{}
+		cfg.Data = map[string]string{DefaultSpecKey: "asset: {type: t, release: r1}\n"}
+		return cfg, nil
+	}
+	spec, err := SpecFromConfigMap(context.Background(), "api", "ns", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "r1", spec.Asset.Release)
+	_, err = SpecFromConfigMap(context.Background(), "api", "ns", "other.yaml")
+	assert.Error(t, err)
+}
+
+func TestSpecFromCustomResource(t *testing.T) {
+	defer setupLoaderTest(t)()
+	getCustomResource = func(ctx context.Context, gvr schema.GroupVersionResource, name, namespace string) (*unstructured.Unstructured, error) {
+		return &unstructured.Unstructured{Object: map[string]any{
+			"spec": map[string]any{
+				"asset": map[string]any{"type": "t", "release": "r1"},
+				"app":   map[string]any{"replicas": int64(2)},
+			},
+		}}, nil
+	}
+	spec, err := SpecFromCustomResource(context.Background(), schema.GroupVersionResource{}, "api", "ns")
+	assert.NoError(t, err)
+	assert.Equal(t, "r1", spec.Asset.Release)
+	assert.EqualValues(t, 2, spec.App["replicas"])
+}
+
+func TestSpecsFromDir(t *testing.T) {
+	root := t.TempDir()
+	write := func(path, content string) {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("api.yaml", "asset: {type: t, release: r1}\n")
+	write("team/worker.json", `{"asset":{"type":"t","release":"r2"}}`)
+	write("README.md", "not a spec")
+	write(".git/config.yaml", "not: a spec")
+
+	specs, err := SpecsFromDir(root)
+	assert.NoError(t, err)
+	assert.Len(t, specs, 2)
+	assert.Equal(t, "r1", specs["api"].Asset.Release)
+	assert.Equal(t, "r2", specs["team/worker"].Asset.Release)
+}
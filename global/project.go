@@ -0,0 +1,132 @@
+package global
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/zhchang/goquiver/raw"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Project represents a project file that declares many named resources at once.
+// Each resource is described by a Spec. Environments hold overlays that are patched over the
+// base resources when the project is resolved for that environment.
+//
+// Fields:
+// Shared: A free-form section that is never interpreted, meant to host YAML anchors reused by resources.
+// Resources: The base specs keyed by resource name.
+// Environments: Overlays keyed by environment name (e.g. dev, staging, prod).
+// DependsOn: The resources to roll out before a resource, keyed by resource name.
+type Project struct {
+	Shared       any                 `yaml:"shared,omitempty" json:"shared,omitempty"`
+	Resources    map[string]*Spec    `yaml:"resources" json:"resources"`
+	Environments map[string]*Overlay `yaml:"environments,omitempty" json:"environments,omitempty"`
+	DependsOn    map[string][]string `yaml:"dependsOn,omitempty" json:"dependsOn,omitempty"`
+}
+
+// Overlay holds the patches applied over the base resources of a project for one environment.
+// Every patch has the same shape as a Spec (`asset` and `app`). Maps are merged recursively,
+// other values replace the base value and a null value removes the key from the base.
+type Overlay struct {
+	Resources map[string]raw.Map `yaml:"resources" json:"resources"`
+}
+
+// ProjectFromYaml parses a project file. The input can be a byte slice, a file path or an io.ReadCloser.
+func ProjectFromYaml(input any) (*Project, error) {
+	var err error
+	var data []byte
+	if data, err = readYamlInput(input); err != nil {
+		return nil, err
+	}
+	var project Project
+	if err = yaml.Unmarshal(data, &project); err != nil {
+		return nil, err
+	}
+	if len(project.Resources) == 0 {
+		return nil, fmt.Errorf("project declares no resources")
+	}
+	for name, dependencies := range project.DependsOn {
+		if _, ok := project.Resources[name]; !ok {
+			return nil, fmt.Errorf("dependencies declared for unknown resource: %s", name)
+		}
+		for _, dependency := range dependencies {
+			if _, ok := project.Resources[dependency]; !ok {
+				return nil, fmt.Errorf("resource %s depends on unknown resource: %s", name, dependency)
+			}
+		}
+	}
+	return &project, nil
+}
+
+// Names returns the resource names of the project in sorted order.
+func (p *Project) Names() []string {
+	names := make([]string, 0, len(p.Resources))
+	for name := range p.Resources {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Specs resolves the specs of every resource for the given environment, as copies the caller may
+// modify. An empty env returns the base specs. It returns an error if env is not declared or if an
+// overlay patches a resource that does not exist in the base.
+func (p *Project) Specs(env string) (map[string]*Spec, error) {
+	var overlay *Overlay
+	if env != "" {
+		var ok bool
+		if overlay, ok = p.Environments[env]; !ok || overlay == nil {
+			return nil, fmt.Errorf("environment not found: %s", env)
+		}
+		for name := range overlay.Resources {
+			if _, ok = p.Resources[name]; !ok {
+				return nil, fmt.Errorf("environment %s patches unknown resource: %s", env, name)
+			}
+		}
+	}
+	specs := map[string]*Spec{}
+	for _, name := range p.Names() {
+		if p.Resources[name] == nil {
+			return nil, fmt.Errorf("empty spec for resource: %s", name)
+		}
+		// callers and overlays must not change the project through the returned specs
+		base := p.Resources[name].DeepCopy()
+		if overlay == nil || overlay.Resources[name] == nil {
+			specs[name] = base
+			continue
+		}
+		merged := applyOverlay(raw.Map{
+			"asset": raw.Map{"type": base.Asset.Typ, "release": base.Asset.Release},
+			"app":   base.App,
+		}, overlay.Resources[name])
+		data, err := yaml.Marshal(merged)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply %s overlay to %s: %w", env, name, err)
+		}
+		if specs[name], err = SpecFromYaml(data); err != nil {
+			return nil, fmt.Errorf("failed to apply %s overlay to %s: %w", env, name, err)
+		}
+	}
+	return specs, nil
+}
+
+func applyOverlay(base, patch raw.Map) raw.Map {
+	r := make(raw.Map, len(base))
+	for key, value := range base {
+		r[key] = value
+	}
+	for key, value := range patch {
+		if value == nil {
+			delete(r, key)
+			continue
+		}
+		if pm, ok := value.(raw.Map); ok {
+			if bm, ok := r[key].(raw.Map); ok {
+				r[key] = applyOverlay(bm, pm)
+				continue
+			}
+		}
+		r[key] = value
+	}
+	return r
+}
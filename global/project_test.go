@@ -0,0 +1,101 @@
+package global
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhchang/goquiver/raw"
+)
+
+var projectYaml = `
+shared:
+  app: &app
+    replicas: 1
+    image: api:1
+    env:
+      LOG: info
+resources:
+  api:
+    asset:
+      type: service
+      release: v1
+    app:
+      <<: *app
+  worker:
+    asset:
+      type: worker
+      release: v2
+    app:
+      <<: *app
+      image: worker:1
+environments:
+  prod:
+    resources:
+      api:
+        asset:
+          release: v3
+        app:
+          replicas: 3
+          env:
+            LOG: warn
+            DEBUG: null
+`
+
+func TestProjectSpecs(t *testing.T) {
+	project, err := ProjectFromYaml([]byte(projectYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"api", "worker"}, project.Names())
+
+	base, err := project.Specs("")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", base["api"].Asset.Release)
+	assert.Equal(t, "worker:1", base["worker"].App["image"])
+	assert.Equal(t, 1, base["worker"].App["replicas"])
+
+	prod, err := project.Specs("prod")
+	assert.NoError(t, err)
+	assert.Equal(t, "service", prod["api"].Asset.Typ)
+	assert.Equal(t, "v3", prod["api"].Asset.Release)
+	assert.Equal(t, 3, prod["api"].App["replicas"])
+	assert.Equal(t, "api:1", prod["api"].App["image"])
+	assert.Equal(t, raw.Map{"LOG": "warn"}, prod["api"].App["env"])
+	assert.Equal(t, base["worker"], prod["worker"])
+	assert.Equal(t, "v1", base["api"].Asset.Release, "base should not be mutated by overlays")
+
+	base["api"].App["env"].(raw.Map)["LOG"] = "debug"
+	base["api"].Asset.Release = "v9"
+	again, err := project.Specs("")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", again["api"].Asset.Release)
+	assert.Equal(t, raw.Map{"LOG": "info"}, again["api"].App["env"])
+	assert.Equal(t, raw.Map{"LOG": "info"}, again["worker"].App["env"])
+}
+
+func TestProjectSpecs_Errors(t *testing.T) {
+	project, err := ProjectFromYaml([]byte(projectYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = project.Specs("staging")
+	assert.Error(t, err)
+
+	project.Environments["dev"] = &Overlay{Resources: map[string]raw.Map{"ghost": {"app": raw.Map{}}}}
+	_, err = project.Specs("dev")
+	assert.Error(t, err)
+
+	_, err = ProjectFromYaml([]byte("resources: {}"))
+	assert.Error(t, err)
+
+	_, err = ProjectFromYaml([]byte(projectYaml + "dependsOn:\n  api: [db]\n"))
+	assert.ErrorContains(t, err, "unknown resource: db")
+	_, err = ProjectFromYaml([]byte(projectYaml + "dependsOn:\n  db: [api]\n"))
+	assert.ErrorContains(t, err, "unknown resource: db")
+}
+
+func TestProjectDependsOn(t *testing.T) {
+	project, err := ProjectFromYaml([]byte(projectYaml + "dependsOn:\n  worker: [api]\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"worker": {"api"}}, project.DependsOn)
+}
@@ -0,0 +1,149 @@
+package global
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+// DefaultRotationAnnotation is the annotation that enables ("enabled") or disables ("disabled")
+// the rotation of a StatefulSet, overriding the image blacklist.
+const DefaultRotationAnnotation = "foreman/rotation"
+
+// RotationPolicy decides when StatefulSets are rotated, i.e. replaced by a new StatefulSet named
+// `<name>---<n+1>` instead of being updated in place.
+//
+// Fields:
+// AnnotationKey: The annotation enabling or disabling rotation per StatefulSet, DefaultRotationAnnotation when empty.
+// ImageBlacklist: Patterns of images whose StatefulSets are not rotated unless annotated, the redis and postgres images when nil.
+// InPlaceFields: The spec fields that are updated in place, a change to any other spec field triggers a rotation. template, replicas and updateStrategy when nil.
+// SingleReplicaInPlace: Update single-replica StatefulSets like the others, instead of rotating them on any spec change but a replicas change.
+type RotationPolicy struct {
+	AnnotationKey        string   `json:"annotationKey,omitempty" yaml:"annotationKey,omitempty"`
+	ImageBlacklist       []string `json:"imageBlacklist,omitempty" yaml:"imageBlacklist,omitempty"`
+	InPlaceFields        []string `json:"inPlaceFields,omitempty" yaml:"inPlaceFields,omitempty"`
+	SingleReplicaInPlace bool     `json:"singleReplicaInPlace,omitempty" yaml:"singleReplicaInPlace,omitempty"`
+
+	// blacklist caches the compiled ImageBlacklist, it is set when the policy is built and never
+	// changed afterwards, so that policies can be shared by concurrent rollouts.
+	blacklist *compiledBlacklist
+}
+
+// compiledBlacklist is an image blacklist compiled once. err is the first pattern that failed to
+// compile, the invalid patterns are left out of regexps.
+type compiledBlacklist struct {
+	patterns []string
+	regexps  []*regexp.Regexp
+	err      error
+}
+
+func compileBlacklist(patterns []string) *compiledBlacklist {
+	c := &compiledBlacklist{patterns: slices.Clone(patterns)}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			if c.err == nil {
+				c.err = fmt.Errorf("invalid rotation image blacklist pattern %s: %w", pattern, err)
+			}
+			continue
+		}
+		c.regexps = append(c.regexps, re)
+	}
+	return c
+}
+
+// compiled returns the compiled ImageBlacklist, compiling it again only if it changed since the
+// policy was built.
+func (p *RotationPolicy) compiled() *compiledBlacklist {
+	if c := p.blacklist; c != nil && slices.Equal(c.patterns, p.ImageBlacklist) {
+		return c
+	}
+	return compileBlacklist(p.ImageBlacklist)
+}
+
+var defaultImageBlacklist = []string{`^(docker.io\/)*redis`, `^(docker.io\/)*postgres`}
+
+var defaultBlacklist = compileBlacklist(defaultImageBlacklist)
+
+var defaultInPlaceFields = []string{"template", "replicas", "updateStrategy"}
+
+// DefaultRotationPolicy returns the policy used when none is configured.
+func DefaultRotationPolicy() *RotationPolicy {
+	return &RotationPolicy{
+		AnnotationKey:  DefaultRotationAnnotation,
+		ImageBlacklist: slices.Clone(defaultImageBlacklist),
+		InPlaceFields:  slices.Clone(defaultInPlaceFields),
+		blacklist:      defaultBlacklist,
+	}
+}
+
+// WithDefaults returns a copy of p whose unset fields are taken from DefaultRotationPolicy. A nil
+// policy yields the default policy.
+func (p *RotationPolicy) WithDefaults() *RotationPolicy {
+	return p.Over(DefaultRotationPolicy())
+}
+
+// Over returns a copy of p whose unset fields are taken from base. SingleReplicaInPlace is set when
+// it is set in either. A nil policy yields a copy of base.
+func (p *RotationPolicy) Over(base *RotationPolicy) *RotationPolicy {
+	r := &RotationPolicy{
+		AnnotationKey:        base.AnnotationKey,
+		ImageBlacklist:       slices.Clone(base.ImageBlacklist),
+		InPlaceFields:        slices.Clone(base.InPlaceFields),
+		SingleReplicaInPlace: base.SingleReplicaInPlace,
+	}
+	blacklist := base.compiled()
+	if p == nil {
+		r.blacklist = blacklist
+		return r
+	}
+	if p.AnnotationKey != "" {
+		r.AnnotationKey = p.AnnotationKey
+	}
+	if p.ImageBlacklist != nil {
+		r.ImageBlacklist = slices.Clone(p.ImageBlacklist)
+		blacklist = p.compiled()
+	}
+	if p.InPlaceFields != nil {
+		r.InPlaceFields = slices.Clone(p.InPlaceFields)
+	}
+	r.SingleReplicaInPlace = r.SingleReplicaInPlace || p.SingleReplicaInPlace
+	r.blacklist = blacklist
+	return r
+}
+
+// Validate checks that the image blacklist patterns compile.
+func (p *RotationPolicy) Validate() error {
+	return p.compiled().err
+}
+
+// Blacklisted reports whether image matches one of the image blacklist patterns. Invalid patterns
+// never match.
+func (p *RotationPolicy) Blacklisted(image string) bool {
+	return slices.ContainsFunc(p.compiled().regexps, func(re *regexp.Regexp) bool {
+		return re.MatchString(image)
+	})
+}
+
+// InPlace reports whether a change to the given spec field can be updated in place.
+func (p *RotationPolicy) InPlace(field string) bool {
+	return slices.Contains(p.InPlaceFields, field)
+}
+
+// RotationPolicyOf returns the StatefulSet rotation policy of rc. Contexts provide one with a
+// `RotationPolicy() *RotationPolicy` method, unset fields keep their default. Other contexts use
+// DefaultRotationPolicy.
+func RotationPolicyOf(rc ResourceContext) *RotationPolicy {
+	if p, ok := rc.(interface{ RotationPolicy() *RotationPolicy }); ok {
+		if policy := p.RotationPolicy(); policy != nil {
+			return policy.WithDefaults()
+		}
+	}
+	return DefaultRotationPolicy()
+}
+
+// WithRotationPolicy sets the StatefulSet rotation policy of the context. Unset fields of policy
+// keep their default.
+func WithRotationPolicy(policy *RotationPolicy) ContextOption {
+	return func(r *rcImpl) { r.rotationPolicy = policy.WithDefaults() }
+}
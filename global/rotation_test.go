@@ -0,0 +1,78 @@
+package global
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotationPolicy(t *testing.T) {
+	policy := DefaultRotationPolicy()
+	assert.True(t, policy.Blacklisted("docker.io/redis:7"))
+	assert.True(t, policy.Blacklisted("postgres:16"))
+	assert.False(t, policy.Blacklisted("app:1"))
+	assert.True(t, policy.InPlace("replicas"))
+	assert.False(t, policy.InPlace("volumeClaimTemplates"))
+
+	custom := (&RotationPolicy{ImageBlacklist: []string{`^mysql`}, SingleReplicaInPlace: true}).WithDefaults()
+	assert.Equal(t, DefaultRotationAnnotation, custom.AnnotationKey)
+	assert.Equal(t, []string{"template", "replicas", "updateStrategy"}, custom.InPlaceFields)
+	assert.True(t, custom.Blacklisted("mysql:8"))
+	assert.False(t, custom.Blacklisted("redis:7"))
+	assert.True(t, custom.SingleReplicaInPlace)
+
+	none := (&RotationPolicy{ImageBlacklist: []string{}}).WithDefaults()
+	assert.False(t, none.Blacklisted("redis:7"))
+
+	assert.Error(t, (&RotationPolicy{ImageBlacklist: []string{"("}}).Validate())
+	assert.NoError(t, policy.Validate())
+
+	assert.Equal(t, DefaultRotationPolicy(), RotationPolicyOf(NewContext(context.Background())))
+	rc := NewContext(context.Background(), WithRotationPolicy(&RotationPolicy{AnnotationKey: "example.com/rotate"}))
+	assert.Equal(t, "example.com/rotate", RotationPolicyOf(rc).AnnotationKey)
+	assert.True(t, RotationPolicyOf(rc).Blacklisted("redis:7"))
+
+	base := &RotationPolicy{AnnotationKey: "example.com/rotate", ImageBlacklist: []string{`^redis`}, InPlaceFields: []string{"template"}, SingleReplicaInPlace: true}
+	merged := (&RotationPolicy{ImageBlacklist: []string{`^mysql`}}).Over(base)
+	assert.Equal(t, RotationPolicy{AnnotationKey: "example.com/rotate", ImageBlacklist: []string{`^mysql`}, InPlaceFields: []string{"template"}, SingleReplicaInPlace: true}, withoutCache(merged))
+	assert.True(t, merged.Blacklisted("mysql:8"))
+	assert.Equal(t, []string{`^redis`}, base.ImageBlacklist)
+	assert.Equal(t, *base, withoutCache((*RotationPolicy)(nil).Over(base)))
+}
+
+func withoutCache(p *RotationPolicy) RotationPolicy {
+	r := *p
+	r.blacklist = nil
+	return r
+}
+
+type externalContext struct {
+	ResourceContext
+	policy *RotationPolicy
+}
+
+func (c *externalContext) RotationPolicy() *RotationPolicy {
+	return c.policy
+}
+
+func TestRotationPolicyOf(t *testing.T) {
+	rc := NewContext(context.Background())
+	assert.Equal(t, DefaultRotationPolicy(), RotationPolicyOf(struct{ ResourceContext }{rc}))
+	assert.Equal(t, DefaultRotationPolicy(), RotationPolicyOf(&externalContext{ResourceContext: rc}))
+	policy := RotationPolicyOf(&externalContext{ResourceContext: rc, policy: &RotationPolicy{AnnotationKey: "example.com/rotate"}})
+	assert.Equal(t, "example.com/rotate", policy.AnnotationKey)
+	assert.Equal(t, DefaultRotationPolicy().InPlaceFields, policy.InPlaceFields)
+}
+
+func TestRotationPolicyBlacklistCache(t *testing.T) {
+	policy := (&RotationPolicy{ImageBlacklist: []string{`^mysql`, "("}}).WithDefaults()
+	assert.Len(t, policy.blacklist.regexps, 1)
+	assert.Error(t, policy.Validate())
+	assert.True(t, policy.Blacklisted("mysql:8"))
+
+	policy.ImageBlacklist = []string{`^redis`}
+	assert.NoError(t, policy.Validate())
+	assert.True(t, policy.Blacklisted("redis:7"))
+	assert.False(t, policy.Blacklisted("mysql:8"))
+}
@@ -0,0 +1,179 @@
+package global
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+//go:embed spec.schema.json
+var specSchema []byte
+
+// SpecSchema returns the JSON Schema describing the Spec format, usable by editors and other tooling.
+func SpecSchema() []byte {
+	return bytes.Clone(specSchema)
+}
+
+type specOptions struct {
+	strict bool
+}
+
+type SpecOption func(*specOptions)
+
+// WithStrict enables strict parsing: unknown fields are rejected, asset type and release are required
+// and problems are reported as SpecError values carrying their position in the input.
+func WithStrict() SpecOption {
+	return func(opts *specOptions) {
+		opts.strict = true
+	}
+}
+
+func newSpecOptions(options ...SpecOption) *specOptions {
+	opts := &specOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+	return opts
+}
+
+// SpecError describes a problem found while strictly parsing a spec.
+// Line and Column are 1-based and are 0 when the position is unknown.
+type SpecError struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *SpecError) Error() string {
+	if e.Line == 0 {
+		return e.Msg
+	}
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+var specFields = map[string]map[string]struct{}{
+	"":      {"asset": {}, "app": {}},
+	"asset": {"type": {}, "release": {}},
+}
+
+var yamlLineRegex = regexp.MustCompile(`line (\d+)`)
+
+func strictSpecFromYaml(data []byte) (*Spec, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		se := &SpecError{Msg: err.Error()}
+		if matches := yamlLineRegex.FindStringSubmatch(err.Error()); matches != nil {
+			se.Line, _ = strconv.Atoi(matches[1])
+		}
+		return nil, se
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return nil, &SpecError{Msg: "empty spec"}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, &SpecError{Line: root.Line, Column: root.Column, Msg: "spec must be a mapping"}
+	}
+	var errs []error
+	var asset *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		if _, ok := specFields[""][key.Value]; !ok {
+			errs = append(errs, &SpecError{Line: key.Line, Column: key.Column, Msg: fmt.Sprintf("unknown field %q", key.Value)})
+			continue
+		}
+		switch key.Value {
+		case "asset":
+			asset = value
+		case "app":
+			if value.Kind != yaml.MappingNode && value.Tag != "!!null" {
+				errs = append(errs, &SpecError{Line: value.Line, Column: value.Column, Msg: "app must be a mapping"})
+			}
+		}
+	}
+	if asset == nil {
+		errs = append(errs, &SpecError{Line: root.Line, Column: root.Column, Msg: "missing required field \"asset\""})
+	} else if asset.Kind != yaml.MappingNode {
+		errs = append(errs, &SpecError{Line: asset.Line, Column: asset.Column, Msg: "asset must be a mapping"})
+	} else {
+		found := map[string]bool{}
+		for i := 0; i+1 < len(asset.Content); i += 2 {
+			key, value := asset.Content[i], asset.Content[i+1]
+			if _, ok := specFields["asset"][key.Value]; !ok {
+				errs = append(errs, &SpecError{Line: key.Line, Column: key.Column, Msg: fmt.Sprintf("unknown field \"asset.%s\"", key.Value)})
+				continue
+			}
+			if value.Kind != yaml.ScalarNode || value.Tag == "!!null" || value.Value == "" {
+				errs = append(errs, &SpecError{Line: value.Line, Column: value.Column, Msg: fmt.Sprintf("asset.%s must be a non-empty string", key.Value)})
+			}
+			found[key.Value] = true
+		}
+		for _, field := range []string{"type", "release"} {
+			if !found[field] {
+				errs = append(errs, &SpecError{Line: asset.Line, Column: asset.Column, Msg: fmt.Sprintf("missing required field \"asset.%s\"", field)})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	var spec Spec
+	if err := root.Decode(&spec); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+func strictSpecFromJSON(data []byte) (*Spec, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var spec Spec
+	if err := dec.Decode(&spec); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			line, column := offsetPosition(data, syntaxErr.Offset)
+			return nil, &SpecError{Line: line, Column: column, Msg: err.Error()}
+		case errors.As(err, &typeErr):
+			line, column := offsetPosition(data, typeErr.Offset)
+			return nil, &SpecError{Line: line, Column: column, Msg: err.Error()}
+		default:
+			return nil, &SpecError{Msg: err.Error()}
+		}
+	}
+	var errs []error
+	if spec.Asset.Typ == "" {
+		errs = append(errs, &SpecError{Msg: "missing required field \"asset.type\""})
+	}
+	if spec.Asset.Release == "" {
+		errs = append(errs, &SpecError{Msg: "missing required field \"asset.release\""})
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return &spec, nil
+}
+
+func offsetPosition(data []byte, offset int64) (line, column int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	line = 1
+	column = 1
+	for _, c := range data[:offset] {
+		if c == '\n' {
+			line++
+			column = 1
+			continue
+		}
+		column++
+	}
+	return
+}
@@ -0,0 +1,79 @@
+package global
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpecFromYaml_Strict(t *testing.T) {
+	spec, err := SpecFromYaml([]byte(`
+asset:
+  type: service
+  release: v1
+app:
+  replicas: 2
+`), WithStrict())
+	assert.NoError(t, err)
+	assert.Equal(t, "service", spec.Asset.Typ)
+	assert.Equal(t, 2, spec.App["replicas"])
+
+	_, err = SpecFromYaml([]byte(`
+assets:
+  type: service
+asset:
+  type: service
+  relase: v1
+`), WithStrict())
+	var se *SpecError
+	assert.True(t, errors.As(err, &se))
+	assert.Equal(t, 2, se.Line)
+	assert.Equal(t, 1, se.Column)
+	assert.Contains(t, err.Error(), `unknown field "assets"`)
+	assert.Contains(t, err.Error(), `line 6, column 3: unknown field "asset.relase"`)
+	assert.Contains(t, err.Error(), `missing required field "asset.release"`)
+
+	_, err = SpecFromYaml([]byte("asset: [\n"), WithStrict())
+	assert.True(t, errors.As(err, &se))
+
+	// lenient parsing keeps ignoring unknown fields
+	spec, err = SpecFromYaml([]byte("assets: {}\nasset: {type: t}\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "t", spec.Asset.Typ)
+}
+
+func TestSpecFromJSON_Strict(t *testing.T) {
+	_, err := SpecFromJSON([]byte(`{"asset":{"type":"t","release":"r"},"app":{}}`), WithStrict())
+	assert.NoError(t, err)
+
+	_, err = SpecFromJSON([]byte(`{"asset":{"type":"t","release":"r"},"relase":"x"}`), WithStrict())
+	assert.ErrorContains(t, err, `unknown field "relase"`)
+
+	_, err = SpecFromJSON([]byte(`{"asset":{"type":"t"}}`), WithStrict())
+	assert.ErrorContains(t, err, `missing required field "asset.release"`)
+
+	_, err = SpecFromJSON([]byte("{\n  \"asset\": 1\n}"), WithStrict())
+	var se *SpecError
+	assert.True(t, errors.As(err, &se))
+	assert.Equal(t, 2, se.Line)
+}
+
+func TestSpecSchema(t *testing.T) {
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource("spec.schema.json", bytes.NewReader(SpecSchema())); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := compiler.Compile("spec.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var valid, invalid any
+	_ = json.Unmarshal([]byte(`{"asset":{"type":"t","release":"r"},"app":{"a":1}}`), &valid)
+	_ = json.Unmarshal([]byte(`{"asset":{"type":"t","relase":"r"}}`), &invalid)
+	assert.NoError(t, schema.Validate(valid))
+	assert.Error(t, schema.Validate(invalid))
+}
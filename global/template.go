@@ -0,0 +1,145 @@
+package global
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/zhchang/goquiver/raw"
+)
+
+// ExpandValues resolves `${path.to.key}` references found in string values against scope.
+// A string consisting of a single reference is replaced by the referenced value as is, so
+// numbers, booleans and maps keep their type; references embedded in longer strings are
+// interpolated and must resolve to scalars. `$${` escapes a literal `${`.
+// The input map is not modified. An error is returned for any reference that cannot be resolved.
+func ExpandValues(values raw.Map, scope raw.Map) (raw.Map, error) {
+	expanded, err := expandValue(values, scope, "")
+	if err != nil {
+		return nil, err
+	}
+	if expanded == nil {
+		return nil, nil
+	}
+	return expanded.(raw.Map), nil
+}
+
+// TemplateScope builds the scope used by ExpandValues from the merged global map returned by GlobalSpec.
+// References are rooted at `global` (the whole map) and `plugins` (the values loaded by each plugin of rc).
+func TemplateScope(rc ResourceContext, g raw.Map) raw.Map {
+	plugins := raw.Map{}
+	for _, plugin := range rc.Plugins() {
+		if value, ok := g[plugin.Name]; ok {
+			plugins[plugin.Name] = value
+		}
+	}
+	return raw.Map{"global": g, "plugins": plugins}
+}
+
+func expandValue(value any, scope raw.Map, at string) (any, error) {
+	switch v := value.(type) {
+	case raw.Map:
+		if v == nil {
+			return v, nil
+		}
+		r := make(raw.Map, len(v))
+		for key, item := range v {
+			var err error
+			if r[key], err = expandValue(item, scope, joinPath(at, key)); err != nil {
+				return nil, err
+			}
+		}
+		return r, nil
+	case raw.Slice:
+		if v == nil {
+			return v, nil
+		}
+		r := make(raw.Slice, len(v))
+		for index, item := range v {
+			var err error
+			if r[index], err = expandValue(item, scope, joinPath(at, strconv.Itoa(index))); err != nil {
+				return nil, err
+			}
+		}
+		return r, nil
+	case string:
+		return expandString(v, scope, at)
+	default:
+		return value, nil
+	}
+}
+
+func expandString(s string, scope raw.Map, at string) (any, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	if strings.HasPrefix(s, "${") && strings.Index(s, "}") == len(s)-1 {
+		return resolveReference(s[2:len(s)-1], scope, at)
+	}
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			b.WriteString(s)
+			break
+		}
+		if start > 0 && s[start-1] == '$' {
+			b.WriteString(s[:start-1])
+			b.WriteString("${")
+			s = s[start+2:]
+			continue
+		}
+		end := strings.Index(s[start:], "}")
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated reference at %s: %q", at, s[start:])
+		}
+		end += start
+		resolved, err := resolveReference(s[start+2:end], scope, at)
+		if err != nil {
+			return nil, err
+		}
+		switch resolved.(type) {
+		case raw.Map, raw.Slice:
+			return nil, fmt.Errorf("reference ${%s} at %s can not be interpolated: not a scalar", s[start+2:end], at)
+		}
+		b.WriteString(s[:start])
+		if resolved != nil {
+			b.WriteString(fmt.Sprint(resolved))
+		}
+		s = s[end+1:]
+	}
+	return b.String(), nil
+}
+
+func resolveReference(path string, scope raw.Map, at string) (any, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, fmt.Errorf("empty reference at %s", at)
+	}
+	var running any = scope
+	for _, key := range strings.Split(path, ".") {
+		switch v := running.(type) {
+		case raw.Map:
+			var ok bool
+			if running, ok = v[key]; !ok {
+				return nil, fmt.Errorf("unresolved reference ${%s} at %s", path, at)
+			}
+		case raw.Slice:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, fmt.Errorf("unresolved reference ${%s} at %s", path, at)
+			}
+			running = v[index]
+		default:
+			return nil, fmt.Errorf("unresolved reference ${%s} at %s", path, at)
+		}
+	}
+	return running, nil
+}
+
+func joinPath(at, key string) string {
+	if at == "" {
+		return key
+	}
+	return at + "." + key
+}
@@ -0,0 +1,69 @@
+package global
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhchang/goquiver/raw"
+)
+
+func TestExpandValues(t *testing.T) {
+	scope := raw.Map{
+		"global": raw.Map{
+			"cluster":  "prod",
+			"replicas": 3,
+			"redis":    raw.Map{"host": "redis.local", "port": 6379},
+		},
+		"plugins": raw.Map{
+			"redis": raw.Map{"host": "redis.local", "port": 6379},
+		},
+	}
+	values := raw.Map{
+		"cluster":  "${global.cluster}",
+		"replicas": "${global.replicas}",
+		"endpoint": "${plugins.redis.host}:${plugins.redis.port}",
+		"redis":    "${plugins.redis}",
+		"escaped":  "$${global.cluster}",
+		"list":     raw.Slice{"name-${global.cluster}", 1},
+		"plain":    "nothing to see",
+	}
+	expanded, err := ExpandValues(values, scope)
+	assert.NoError(t, err)
+	assert.Equal(t, "prod", expanded["cluster"])
+	assert.Equal(t, 3, expanded["replicas"])
+	assert.Equal(t, "redis.local:6379", expanded["endpoint"])
+	assert.Equal(t, raw.Map{"host": "redis.local", "port": 6379}, expanded["redis"])
+	assert.Equal(t, "${global.cluster}", expanded["escaped"])
+	assert.Equal(t, raw.Slice{"name-prod", 1}, expanded["list"])
+	assert.Equal(t, "nothing to see", expanded["plain"])
+	assert.Equal(t, "${global.cluster}", values["cluster"], "input should not be mutated")
+}
+
+func TestExpandValues_Unresolved(t *testing.T) {
+	scope := raw.Map{"global": raw.Map{"cluster": "prod"}}
+	cases := []struct {
+		desc  string
+		value string
+	}{
+		{"missing key", "${global.region}"},
+		{"missing root", "${plugins.redis.host}"},
+		{"non scalar interpolation", "x-${global}"},
+		{"empty reference", "${}"},
+		{"unterminated", "x-${global.cluster"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := ExpandValues(raw.Map{"nested": raw.Map{"key": tc.value}}, scope)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestTemplateScope(t *testing.T) {
+	rc := NewContext(context.Background(), WithPlugins([]*Plugin{{Name: "redis"}, {Name: "absent"}}))
+	g := raw.Map{"cluster": "prod", "redis": raw.Map{"host": "h"}}
+	scope := TemplateScope(rc, g)
+	assert.Equal(t, g, scope["global"])
+	assert.Equal(t, raw.Map{"redis": raw.Map{"host": "h"}}, scope["plugins"])
+}
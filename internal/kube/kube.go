@@ -0,0 +1,79 @@
+// Package kube provides access to the Kubernetes client-go clients that are not exposed by
+// "github.com/zhchang/goquiver/k8s", such as the dynamic client, a RESTMapper and the typed clientset.
+//
+// The clients are built from the same configuration goquiver uses: the in-cluster config,
+// falling back to the kubeconfig pointed to by KUBECONFIG or the default kubeconfig path.
+package kube
+
+import (
+	"os"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+var once sync.Once
+var initErr error
+var dynClient dynamic.Interface
+var mapper meta.RESTMapper
+var clientset kubernetes.Interface
+
+func initClients() error {
+	once.Do(func() {
+		var config *rest.Config
+		if config, initErr = rest.InClusterConfig(); initErr != nil {
+			kubeconfigPath := os.Getenv("KUBECONFIG")
+			if kubeconfigPath == "" {
+				kubeconfigPath = clientcmd.NewDefaultClientConfigLoadingRules().GetDefaultFilename()
+			}
+			if config, initErr = clientcmd.BuildConfigFromFlags("", kubeconfigPath); initErr != nil {
+				return
+			}
+		}
+		config.QPS = 100
+		config.Burst = 500
+		if dynClient, initErr = dynamic.NewForConfig(config); initErr != nil {
+			return
+		}
+		if clientset, initErr = kubernetes.NewForConfig(config); initErr != nil {
+			return
+		}
+		var dc *discovery.DiscoveryClient
+		if dc, initErr = discovery.NewDiscoveryClientForConfig(config); initErr != nil {
+			return
+		}
+		mapper = restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(dc))
+	})
+	return initErr
+}
+
+// Dynamic returns the dynamic client, initializing the clients on first use.
+func Dynamic() (dynamic.Interface, error) {
+	if err := initClients(); err != nil {
+		return nil, err
+	}
+	return dynClient, nil
+}
+
+// Mapper returns a RESTMapper backed by the cached discovery information of the cluster.
+func Mapper() (meta.RESTMapper, error) {
+	if err := initClients(); err != nil {
+		return nil, err
+	}
+	return mapper, nil
+}
+
+// Clientset returns the typed clientset, for the APIs goquiver does not wrap such as pod logs.
+func Clientset() (kubernetes.Interface, error) {
+	if err := initClients(); err != nil {
+		return nil, err
+	}
+	return clientset, nil
+}
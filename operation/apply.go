@@ -0,0 +1,191 @@
+package operation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nextbillion-ai/goreman-util/global"
+	"github.com/nextbillion-ai/goreman-util/internal/kube"
+	"github.com/zhchang/goquiver/k8s"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// DefaultFieldManager is the field manager used for server-side apply when none is given.
+const DefaultFieldManager = "goreman"
+
+// WithServerSideApply makes Rollout apply objects with server-side apply as fieldManager instead of
+// replacing them, so fields owned by other managers (HPA replicas, injected sidecars...) are kept.
+// An empty fieldManager means DefaultFieldManager. Conflicts fail the rollout with a *ConflictError
+// unless WithForceConflicts is used. Objects of kinds k8s.Rollout does not support are always
+// applied with server-side apply.
+func WithServerSideApply(fieldManager string) OperationOption {
+	return func(opts *operationOptions) {
+		if fieldManager == "" {
+			fieldManager = DefaultFieldManager
+		}
+		opts.fieldManager = fieldManager
+	}
+}
+
+// WithForceConflicts makes server-side apply take over the fields owned by other managers. The
+// conflicts are logged before they are forced.
+func WithForceConflicts() OperationOption {
+	return func(opts *operationOptions) {
+		opts.forceConflicts = true
+	}
+}
+
+// rolloutKinds are the kinds k8s.Rollout can apply. Objects of other kinds, like the
+// VerticalPodAutoscalers or ServiceMonitors retargeted to a rotation, are applied with server-side
+// apply as DefaultFieldManager.
+var rolloutKinds = []k8s.Kind{
+	k8s.KindDeployment,
+	k8s.KindStatefulSet,
+	k8s.KindDaemonSet,
+	k8s.KindJob,
+	k8s.KindCronJob,
+	k8s.KindPod,
+	k8s.KindConfigMap,
+	k8s.KindSecret,
+	k8s.KindService,
+	k8s.KindIngress,
+	k8s.KindPodDisruptionBudget,
+	k8s.KindHorizontalPodAutoscaler,
+	k8s.KindStorageClass,
+	k8s.KindPersistentVolume,
+	k8s.KindPersistentVolumeClaim,
+	k8s.KindCustomResourceDefinition,
+	k8s.KindServiceAccount,
+	k8s.KindClusterRole,
+	k8s.KindClusterRoleBinding,
+	k8s.KindRole,
+	k8s.KindRoleBinding,
+}
+
+// FieldConflict is a field of an object that is owned by another field manager.
+type FieldConflict struct {
+	Manager string
+	Field   string
+	Message string
+}
+
+// ConflictError reports the fields server-side apply could not take over from other managers.
+type ConflictError struct {
+	Kind      k8s.Kind
+	Namespace string
+	Name      string
+	Conflicts []FieldConflict
+}
+
+func (e *ConflictError) Error() string {
+	var conflicts []string
+	for _, c := range e.Conflicts {
+		conflicts = append(conflicts, fmt.Sprintf("%s (managed by %s)", c.Field, c.Manager))
+	}
+	return fmt.Sprintf("apply conflicts on %s %s/%s: %s", e.Kind, e.Namespace, e.Name, strings.Join(conflicts, ", "))
+}
+
+var conflictManagerRegex = regexp.MustCompile(`conflict with "([^"]*)"`)
+
+// fieldConflicts extracts the field manager conflicts reported by a failed server-side apply.
+func fieldConflicts(err error) []FieldConflict {
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) || status.Status().Details == nil {
+		return nil
+	}
+	var conflicts []FieldConflict
+	for _, cause := range status.Status().Details.Causes {
+		if cause.Type != metav1.CauseTypeFieldManagerConflict {
+			continue
+		}
+		conflict := FieldConflict{Field: cause.Field, Message: cause.Message}
+		if m := conflictManagerRegex.FindStringSubmatch(cause.Message); m != nil {
+			conflict.Manager = m[1]
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	return conflicts
+}
+
+// serverSideApply applies obj with the given field manager through the dynamic client.
+var serverSideApply = func(ctx context.Context, obj *unstructured.Unstructured, fieldManager string, force bool) error {
+	var err error
+	var client dynamic.Interface
+	if client, err = kube.Dynamic(); err != nil {
+		return err
+	}
+	var mapper apimeta.RESTMapper
+	if mapper, err = kube.Mapper(); err != nil {
+		return err
+	}
+	gvk := obj.GroupVersionKind()
+	var mapping *apimeta.RESTMapping
+	if mapping, err = mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+		return err
+	}
+	var ri dynamic.ResourceInterface = client.Resource(mapping.Resource)
+	if mapping.Scope.Name() == apimeta.RESTScopeNameNamespace {
+		ri = client.Resource(mapping.Resource).Namespace(obj.GetNamespace())
+	}
+	var data []byte
+	if data, err = json.Marshal(obj.Object); err != nil {
+		return err
+	}
+	_, err = ri.Patch(ctx, obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{FieldManager: fieldManager, Force: &force})
+	return err
+}
+
+// applyServerSide applies r with server-side apply and waits for it like k8s.Rollout does.
+func applyServerSide(rc global.ResourceContext, r k8s.Resource, opts *operationOptions) error {
+	var err error
+	var u *unstructured.Unstructured
+	if u, err = toUnstructured(r); err != nil {
+		return err
+	}
+	err = serverSideApply(rc.Context(), u, opts.fieldManager, false)
+	if conflicts := fieldConflicts(err); len(conflicts) > 0 {
+		conflictErr := &ConflictError{Kind: u.GetKind(), Namespace: u.GetNamespace(), Name: u.GetName(), Conflicts: conflicts}
+		if !opts.forceConflicts {
+			return conflictErr
+		}
+		rc.Logger().Warnf("forcing %s", conflictErr)
+		err = serverSideApply(rc.Context(), u, opts.fieldManager, true)
+	}
+	if err != nil {
+		return err
+	}
+	if opts.wait > 0 && (u.GetKind() == k8s.KindDeployment || u.GetKind() == k8s.KindStatefulSet) {
+		return waitReady(rc.Context(), u.GetKind(), u.GetName(), u.GetNamespace(), opts.wait)
+	}
+	return nil
+}
+
+// waitReady waits until the workload is ready or d elapses.
+func waitReady(ctx context.Context, kind k8s.Kind, name, namespace string, d time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+	for {
+		ws := workloadStatus(ctx, kind, name, namespace)
+		if ws.Ready {
+			return nil
+		}
+		if ws.Err != nil && !apierrors.IsNotFound(ws.Err) {
+			return ws.Err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
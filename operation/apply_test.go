@@ -0,0 +1,85 @@
+package operation
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nextbillion-ai/goreman-util/global"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhchang/goquiver/k8s"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestApplyServerSide(t *testing.T) {
+	orgServerSideApply := serverSideApply
+	defer func() {
+		serverSideApply = orgServerSideApply
+	}()
+	conflict := apierrors.NewApplyConflict([]metav1.StatusCause{{
+		Type:    metav1.CauseTypeFieldManagerConflict,
+		Message: `conflict with "kube-controller-manager" using apps/v1`,
+		Field:   ".spec.replicas",
+	}}, "Apply failed with 1 conflict")
+	var forced []bool
+	serverSideApply = func(ctx context.Context, obj *unstructured.Unstructured, fieldManager string, force bool) error {
+		assert.Equal(t, "ci", fieldManager)
+		forced = append(forced, force)
+		if force {
+			return nil
+		}
+		return conflict
+	}
+	deploy := &k8s.Deployment{}
+	deploy.APIVersion, deploy.Kind, deploy.Name, deploy.Namespace = "apps/v1", k8s.KindDeployment, "api", "ns"
+	rc := global.NewContext(context.Background(), global.WithLogLevel(logrus.ErrorLevel))
+
+	opts := &operationOptions{}
+	WithServerSideApply("ci")(opts)
+	err := applyServerSide(rc, deploy, opts)
+	var conflictErr *ConflictError
+	assert.True(t, errors.As(err, &conflictErr))
+	assert.Equal(t, []FieldConflict{{Manager: "kube-controller-manager", Field: ".spec.replicas", Message: `conflict with "kube-controller-manager" using apps/v1`}}, conflictErr.Conflicts)
+	assert.ErrorContains(t, err, ".spec.replicas (managed by kube-controller-manager)")
+	assert.Equal(t, []bool{false}, forced)
+
+	forced = nil
+	WithForceConflicts()(opts)
+	assert.NoError(t, applyServerSide(rc, deploy, opts))
+	assert.Equal(t, []bool{false, true}, forced)
+
+	assert.Empty(t, fieldConflicts(errors.New("boom")))
+	opts = &operationOptions{}
+	WithServerSideApply("")(opts)
+	assert.Equal(t, DefaultFieldManager, opts.fieldManager)
+}
+
+func TestApplyObjectUnsupportedKind(t *testing.T) {
+	orgServerSideApply := serverSideApply
+	orgDoRollout := doRollout
+	defer func() {
+		serverSideApply = orgServerSideApply
+		doRollout = orgDoRollout
+	}()
+	var applied, rolledOut []string
+	serverSideApply = func(ctx context.Context, obj *unstructured.Unstructured, fieldManager string, force bool) error {
+		assert.Equal(t, DefaultFieldManager, fieldManager)
+		applied = append(applied, obj.GetKind())
+		return nil
+	}
+	doRollout = func(ctx context.Context, item k8s.Resource, options ...k8s.OperationOption) error {
+		rolledOut = append(rolledOut, item.GetObjectKind().GroupVersionKind().Kind)
+		return nil
+	}
+	list, err := k8s.DecodeAllYAML(retargetManifest)
+	assert.NoError(t, err)
+	rc := global.NewContext(context.Background(), global.WithLogLevel(logrus.ErrorLevel))
+	for _, r := range list {
+		assert.NoError(t, applyObject(rc, r, &operationOptions{}))
+	}
+	assert.Equal(t, []string{"VerticalPodAutoscaler", "NetworkPolicy"}, applied)
+	assert.Equal(t, []string{k8s.KindHorizontalPodAutoscaler, k8s.KindPodDisruptionBudget, k8s.KindService, k8s.KindService, k8s.KindConfigMap}, rolledOut)
+}
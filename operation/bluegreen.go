@@ -0,0 +1,352 @@
+package operation
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nextbillion-ai/goreman-util/global"
+	"github.com/zhchang/goquiver/k8s"
+)
+
+// blueGreenKey holds the blue/green rotations whose previous rotation is still kept.
+const blueGreenKey = "blueGreen"
+
+// DefaultBlueGreenTimeout is how long a blue/green rollout waits for a new rotation to become ready
+// when no wait is set.
+const DefaultBlueGreenTimeout = 10 * time.Minute
+
+// BlueGreenRotation is a StatefulSet rotation done in blue/green mode.
+//
+// Fields:
+// StatefulSet: The name of the StatefulSet in the manifest.
+// Previous: The rotation that served traffic before the switch, kept until promotion.
+// Current: The rotation serving traffic since SwitchedAt.
+// Grace: How long Previous is kept after the switch, 0 keeps it until Promote.
+type BlueGreenRotation struct {
+	StatefulSet string        `json:"statefulSet"`
+	Previous    string        `json:"previous"`
+	Current     string        `json:"current"`
+	SwitchedAt  time.Time     `json:"switchedAt"`
+	Grace       time.Duration `json:"grace"`
+}
+
+// Expired reports whether the grace period of the previous rotation is over.
+func (b *BlueGreenRotation) Expired(now time.Time) bool {
+	return b.Grace > 0 && !now.Before(b.SwitchedAt.Add(b.Grace))
+}
+
+// WithBlueGreen makes StatefulSet rotations blue/green. The Services selecting the pods of a rotated
+// StatefulSet keep sending traffic to the previous rotation until the new one is ready, then their
+// selector is switched to the new rotation through the realname label. The previous rotation is
+// kept for grace, or until Promote when grace is 0, and is removed by the first rollout or Promote
+// after that. If the new rotation does not become ready it is removed and the rollout fails.
+// Rollouts without WithBlueGreen that rotate the StatefulSet move its pinned Services to the new
+// rotation once it is ready.
+func WithBlueGreen(grace time.Duration) OperationOption {
+	return func(opts *operationOptions) {
+		opts.blueGreen = &blueGreen{grace: grace}
+	}
+}
+
+type blueGreen struct {
+	grace    time.Duration
+	pending  []*BlueGreenRotation
+	switches []*BlueGreenRotation
+}
+
+func blueGreenFromData(data map[string]string) []*BlueGreenRotation {
+	var rotations []*BlueGreenRotation
+	if value := data[blueGreenKey]; value != "" {
+		_ = json.Unmarshal([]byte(value), &rotations)
+	}
+	return rotations
+}
+
+func blueGreenData(rotations []*BlueGreenRotation) (map[string]string, error) {
+	if len(rotations) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(rotations)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{blueGreenKey: string(data)}, nil
+}
+
+// load reads the pending blue/green rotations recorded with the manifest of the named resource.
+func (bg *blueGreen) load(rc global.ResourceContext, name string) {
+	if cfg, err := getManifestConfigMap(rc.Context(), name, rc.Namespace()); err == nil {
+		bg.pending = blueGreenFromData(cfg.Data)
+	}
+}
+
+// rotate records that the StatefulSet sts is rotated to current.
+func (bg *blueGreen) rotate(sts, current string) {
+	rotation, err := extractRotation(current)
+	if err != nil || rotation == 0 {
+		return
+	}
+	bg.switches = append(bg.switches, &BlueGreenRotation{
+		StatefulSet: sts,
+		Previous:    strings.TrimSuffix(current, strconv.Itoa(rotation)) + strconv.Itoa(rotation-1),
+		Current:     current,
+		Grace:       bg.grace,
+	})
+}
+
+// keep drops from toRemoves the previous rotations that must be kept: those of the switches of this
+// rollout and those of earlier switches whose grace period is not over. Earlier switches of a
+// StatefulSet rotated again are superseded and their previous rotation is removed.
+func (bg *blueGreen) keep(rc global.ResourceContext, toRemoves []toRemove) []toRemove {
+	now := time.Now()
+	var kept []string
+	var pending []*BlueGreenRotation
+	for _, s := range bg.switches {
+		kept = append(kept, s.Previous)
+	}
+	for _, p := range bg.pending {
+		if slices.ContainsFunc(bg.switches, func(s *BlueGreenRotation) bool { return s.StatefulSet == p.StatefulSet }) || p.Expired(now) {
+			continue
+		}
+		kept = append(kept, p.Previous)
+		pending = append(pending, p)
+	}
+	bg.pending = pending
+	return slices.DeleteFunc(toRemoves, func(r toRemove) bool {
+		if r.kind == k8s.KindStatefulSet && slices.Contains(kept, r.name) {
+			rc.Logger().Infof("keeping previous blue/green rotation %s/%s", r.namespace, r.name)
+			return true
+		}
+		return false
+	})
+}
+
+// serving returns the rotation the Services of the StatefulSet named rotation must select while
+// the rollout is applied.
+func (bg *blueGreen) serving(rotation string) string {
+	for _, s := range bg.switches {
+		if s.Current == rotation {
+			return s.Previous
+		}
+	}
+	return rotation
+}
+
+// rotations returns the blue/green rotations to record with the manifest.
+func (bg *blueGreen) rotations() []*BlueGreenRotation {
+	return append(slices.Clone(bg.switches), bg.pending...)
+}
+
+// cutover waits for the new rotations to be ready and switches the Services of list to them. A
+// rotation that does not become ready is removed and traffic stays on the previous rotation.
+func (bg *blueGreen) cutover(rc global.ResourceContext, list []k8s.Resource, opts *operationOptions, owner *ownership) error {
+	if len(bg.switches) == 0 {
+		return nil
+	}
+	timeout := opts.wait
+	if timeout <= 0 {
+		timeout = DefaultBlueGreenTimeout
+	}
+	for _, s := range bg.switches {
+		if err := waitReady(rc.Context(), k8s.KindStatefulSet, s.Current, rc.Namespace(), timeout); err != nil {
+			rc.Logger().Warnf("blue/green rotation %s is not ready, keeping traffic on %s: %s", s.Current, s.Previous, err)
+			opts.remove(rc, k8s.KindStatefulSet, s.Current, rc.Namespace(), timeout)
+			return fmt.Errorf("blue/green rotation %s is not ready: %w", s.Current, err)
+		}
+	}
+	if err := applyPinnedServices(rc, list, func(rotation string) string { return rotation }, opts, owner); err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, s := range bg.switches {
+		rc.Logger().Infof("switched traffic of %s from %s to %s", s.StatefulSet, s.Previous, s.Current)
+		s.SwitchedAt = now
+	}
+	return nil
+}
+
+// selects reports whether selector selects pods labeled podLabels, ignoring the realname label.
+func selects(selector, podLabels map[string]string) bool {
+	matched := false
+	for key, value := range selector {
+		if key == realNameLabel {
+			continue
+		}
+		if podLabels[key] != value {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// pinServices points the Services of list that select the pods of a StatefulSet of list at the
+// rotation returned by serving for the name of that StatefulSet. It returns the keys of the pinned
+// Services.
+func pinServices(list []k8s.Resource, serving func(string) string) ([]string, error) {
+	var stss []*k8s.StatefulSet
+	for _, r := range list {
+		if r.GetObjectKind().GroupVersionKind().Kind == k8s.KindStatefulSet {
+			sts, err := k8s.Parse[*k8s.StatefulSet](r)
+			if err != nil {
+				return nil, err
+			}
+			stss = append(stss, sts)
+		}
+	}
+	var pinned []string
+	for i, r := range list {
+		if r.GetObjectKind().GroupVersionKind().Kind != k8s.KindService {
+			continue
+		}
+		svc, err := k8s.Parse[*k8s.Service](r)
+		if err != nil {
+			return nil, err
+		}
+		for _, sts := range stss {
+			if !selects(svc.Spec.Selector, sts.Spec.Template.Labels) {
+				continue
+			}
+			svc.Spec.Selector[realNameLabel] = serving(sts.GetName())
+			list[i] = svc
+			pinned = append(pinned, resourceKey(k8s.KindService, svc.GetName()))
+			break
+		}
+	}
+	return pinned, nil
+}
+
+// applyPinnedServices pins the Services of list with pinServices and applies them.
+func applyPinnedServices(rc global.ResourceContext, list []k8s.Resource, serving func(string) string, opts *operationOptions, owner *ownership) error {
+	pinned, err := pinServices(list, serving)
+	if err != nil {
+		return err
+	}
+	for _, r := range list {
+		if !slices.Contains(pinned, resourceKey(r.GetObjectKind().GroupVersionKind().Kind, r.GetName())) {
+			continue
+		}
+		if r, err = owner.stamp(r); err != nil {
+			return err
+		}
+		if err = applyObject(rc, r, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// repinServices points the pinned Services of list, see pinnedTo, at the rotations created by a
+// rollout without WithBlueGreen once these are ready, so that they keep their endpoints when the
+// previous rotations are removed.
+func repinServices(rc global.ResourceContext, list []k8s.Resource, rotations []string, opts *operationOptions, owner *ownership) error {
+	if !slices.ContainsFunc(list, func(r k8s.Resource) bool { return r.GetObjectKind().GroupVersionKind().Kind == k8s.KindService }) {
+		return nil
+	}
+	timeout := opts.wait
+	if timeout <= 0 {
+		timeout = DefaultBlueGreenTimeout
+	}
+	for _, rotation := range rotations {
+		if err := waitReady(rc.Context(), k8s.KindStatefulSet, rotation, rc.Namespace(), timeout); err != nil {
+			return fmt.Errorf("rotation %s is not ready, its Services are kept on the previous rotation: %w", rotation, err)
+		}
+	}
+	return applyPinnedServices(rc, list, func(rotation string) string { return rotation }, opts, owner)
+}
+
+// updateBlueGreen records rotations in the manifest ConfigMap cfg.
+func updateBlueGreen(rc global.ResourceContext, cfg *k8s.ConfigMap, rotations []*BlueGreenRotation) error {
+	data, err := blueGreenData(rotations)
+	if err != nil {
+		return err
+	}
+	delete(cfg.Data, blueGreenKey)
+	for key, value := range data {
+		cfg.Data[key] = value
+	}
+	cfg.Kind = k8s.KindConfigMap
+	return doRollout(rc.Context(), cfg)
+}
+
+// Promote ends the blue/green rotations of the named resource: the previous rotations are removed.
+func Promote(rc global.ResourceContext, name string, options ...OperationOption) error {
+	opts := &operationOptions{}
+	for _, opt := range options {
+		opt(opts)
+	}
+	if opts.result == nil {
+		opts.result = &Result{}
+	}
+	cfg, err := getManifestConfigMap(rc.Context(), name, rc.Namespace())
+	if err != nil {
+		return err
+	}
+	var kept []*BlueGreenRotation
+	for _, s := range blueGreenFromData(cfg.Data) {
+		opts.remove(rc, k8s.KindStatefulSet, s.Previous, rc.Namespace(), opts.wait)
+		if opts.result.Removals[len(opts.result.Removals)-1].Err != nil {
+			kept = append(kept, s)
+			continue
+		}
+		rc.Logger().Infof("promoted %s, removed %s", s.Current, s.Previous)
+	}
+	if err = updateBlueGreen(rc, cfg, kept); err != nil {
+		return err
+	}
+	if failed := opts.result.FailedRemovals(); len(failed) > 0 {
+		return &RemovalError{Failed: failed}
+	}
+	return nil
+}
+
+// Abort rolls back the blue/green rotations of the named resource: traffic is switched back to the
+// previous rotations and the current ones are removed. The recorded manifest still describes the
+// aborted rotations, roll out again to reconcile it.
+func Abort(rc global.ResourceContext, name string, options ...OperationOption) error {
+	opts := &operationOptions{}
+	for _, opt := range options {
+		opt(opts)
+	}
+	if opts.result == nil {
+		opts.result = &Result{}
+	}
+	cfg, err := getManifestConfigMap(rc.Context(), name, rc.Namespace())
+	if err != nil {
+		return err
+	}
+	var recorded []k8s.Resource
+	if recorded, err = k8s.DecodeAllYAML(cfg.Data[manifestKey]); err != nil {
+		return err
+	}
+	rotations := blueGreenFromData(cfg.Data)
+	previous := map[string]string{}
+	for _, s := range rotations {
+		previous[s.StatefulSet] = s.Previous
+	}
+	serving := func(sts string) string {
+		if p, ok := previous[sts]; ok {
+			return p
+		}
+		return liveName(rc.Context(), k8s.KindStatefulSet, sts, rc.Namespace())
+	}
+	owner := &ownership{name: name, record: recordFromData(cfg.Data)}
+	if err = applyPinnedServices(rc, recorded, serving, opts, owner); err != nil {
+		return err
+	}
+	for _, s := range rotations {
+		rc.Logger().Infof("switched traffic of %s back to %s", s.StatefulSet, s.Previous)
+		opts.remove(rc, k8s.KindStatefulSet, s.Current, rc.Namespace(), opts.wait)
+	}
+	if err = updateBlueGreen(rc, cfg, nil); err != nil {
+		return err
+	}
+	if failed := opts.result.FailedRemovals(); len(failed) > 0 {
+		return &RemovalError{Failed: failed}
+	}
+	return nil
+}
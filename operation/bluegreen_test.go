@@ -0,0 +1,336 @@
+package operation
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nextbillion-ai/goreman-util/global"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhchang/goquiver/k8s"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const blueGreenManifest = `
+kind: StatefulSet
+apiVersion: apps/v1
+metadata:
+  name: db
+spec:
+  template:
+    metadata:
+      labels:
+        app: db
+---
+kind: Service
+apiVersion: v1
+metadata:
+  name: db
+spec:
+  selector:
+    app: db
+---
+kind: Service
+apiVersion: v1
+metadata:
+  name: other
+spec:
+  selector:
+    app: other`
+
+func selectorOf(t *testing.T, r k8s.Resource) map[string]string {
+	svc, err := k8s.Parse[*k8s.Service](r)
+	assert.NoError(t, err)
+	return svc.Spec.Selector
+}
+
+func TestPinServices(t *testing.T) {
+	list, err := k8s.DecodeAllYAML(blueGreenManifest)
+	assert.NoError(t, err)
+	pinned, err := pinServices(list, func(sts string) string { return sts + "---1" })
+	assert.NoError(t, err)
+	assert.Equal(t, []string{k8s.KindService + "db"}, pinned)
+	assert.Equal(t, map[string]string{"app": "db", realNameLabel: "db---1"}, selectorOf(t, list[1]))
+	assert.Equal(t, map[string]string{"app": "other"}, selectorOf(t, list[2]))
+	assert.False(t, selects(map[string]string{realNameLabel: "db---1"}, map[string]string{realNameLabel: "db---1"}))
+}
+
+func TestBlueGreenFirstInstall(t *testing.T) {
+	orgDoRollout := doRollout
+	defer func() { doRollout = orgDoRollout }()
+	applied := map[string]k8s.Resource{}
+	doRollout = func(ctx context.Context, item k8s.Resource, options ...k8s.OperationOption) error {
+		applied[item.GetObjectKind().GroupVersionKind().Kind+item.GetName()] = item
+		return nil
+	}
+	rc := global.NewContext(context.Background(), global.WithLogLevel(logrus.ErrorLevel))
+	list, err := k8s.DecodeAllYAML(blueGreenManifest)
+	assert.NoError(t, err)
+	opts := &operationOptions{result: &Result{}, blueGreen: &blueGreen{}}
+	assert.NoError(t, apply(rc, list, nil, opts, map[string]bool{}, nil))
+	sts, err := k8s.Parse[*k8s.StatefulSet](applied[k8s.KindStatefulSet+"db---0"])
+	assert.NoError(t, err)
+	assert.Equal(t, "db---0", sts.Spec.Template.Labels[realNameLabel])
+	assert.Equal(t, "db---0", selectorOf(t, applied[k8s.KindService+"db"])[realNameLabel])
+	assert.NotContains(t, selectorOf(t, applied[k8s.KindService+"other"]), realNameLabel)
+}
+
+func TestBlueGreenKeep(t *testing.T) {
+	rc := global.NewContext(context.Background(), global.WithLogLevel(logrus.ErrorLevel))
+	bg := &blueGreen{grace: time.Hour, pending: []*BlueGreenRotation{
+		{StatefulSet: "db", Previous: "db---1", Current: "db---2", SwitchedAt: time.Now(), Grace: time.Hour},
+		{StatefulSet: "cache", Previous: "cache---4", Current: "cache---5", SwitchedAt: time.Now(), Grace: time.Hour},
+		{StatefulSet: "queue", Previous: "queue---9", Current: "queue---10", SwitchedAt: time.Now().Add(-2 * time.Hour), Grace: time.Hour},
+	}}
+	bg.rotate("db", "db---3")
+	assert.Equal(t, "db---2", bg.switches[0].Previous)
+	assert.Equal(t, "db---2", bg.serving("db---3"))
+	assert.Equal(t, "cache---5", bg.serving("cache---5"))
+
+	toRemoves := bg.keep(rc, []toRemove{
+		{name: "db---1", kind: k8s.KindStatefulSet},
+		{name: "db---2", kind: k8s.KindStatefulSet},
+		{name: "cache---4", kind: k8s.KindStatefulSet},
+		{name: "queue---9", kind: k8s.KindStatefulSet},
+	})
+	assert.Equal(t, []toRemove{{name: "db---1", kind: k8s.KindStatefulSet}, {name: "queue---9", kind: k8s.KindStatefulSet}}, toRemoves)
+	var kept []string
+	for _, r := range bg.rotations() {
+		kept = append(kept, r.Previous)
+	}
+	assert.Equal(t, []string{"db---2", "cache---4"}, kept)
+}
+
+func TestBlueGreenCutover(t *testing.T) {
+	orgGetLive := getLive
+	orgDoRollout := doRollout
+	orgDoRemove := doRemove
+	defer func() {
+		getLive = orgGetLive
+		doRollout = orgDoRollout
+		doRemove = orgDoRemove
+	}()
+	ready := true
+	getLive = func(ctx context.Context, kind k8s.Kind, name, namespace string) (k8s.Resource, error) {
+		sts := &k8s.StatefulSet{}
+		if ready {
+			sts.Status.ReadyReplicas, sts.Status.AvailableReplicas, sts.Status.UpdatedReplicas = 1, 1, 1
+		}
+		return sts, nil
+	}
+	applied := map[string]map[string]string{}
+	doRollout = func(ctx context.Context, item k8s.Resource, options ...k8s.OperationOption) error {
+		applied[item.GetName()] = selectorOf(t, item)
+		return nil
+	}
+	var removed []string
+	doRemove = func(ctx context.Context, name, namespace string, kind k8s.Kind, options ...k8s.OperationOption) error {
+		removed = append(removed, name)
+		return nil
+	}
+	rc := global.NewContext(context.Background(), global.WithLogLevel(logrus.ErrorLevel))
+	list, err := k8s.DecodeAllYAML(blueGreenManifest)
+	assert.NoError(t, err)
+	sts, _ := k8s.Parse[*k8s.StatefulSet](list[0])
+	setRotationName(sts, "db---3")
+	list[0] = sts
+	opts := &operationOptions{wait: 10 * time.Millisecond, result: &Result{}}
+	owner := &ownership{name: "db"}
+
+	bg := &blueGreen{}
+	bg.rotate("db", "db---3")
+	_, err = pinServices(list, bg.serving)
+	assert.NoError(t, err)
+	assert.Equal(t, "db---2", selectorOf(t, list[1])[realNameLabel])
+	assert.NoError(t, bg.cutover(rc, list, opts, owner))
+	assert.Equal(t, "db---3", applied["db"][realNameLabel])
+	assert.False(t, bg.switches[0].SwitchedAt.IsZero())
+	assert.Empty(t, removed)
+
+	ready = false
+	applied = map[string]map[string]string{}
+	bg = &blueGreen{}
+	bg.rotate("db", "db---3")
+	assert.ErrorContains(t, bg.cutover(rc, list, opts, owner), "blue/green rotation db---3 is not ready")
+	assert.Equal(t, []string{"db---3"}, removed)
+	assert.Empty(t, applied)
+}
+
+func TestPromoteAndAbort(t *testing.T) {
+	orgGetManifestConfigMap := getManifestConfigMap
+	orgGetCurrentRotation := getCurrentRotation
+	orgDoRollout := doRollout
+	orgDoRemove := doRemove
+	defer func() {
+		getManifestConfigMap = orgGetManifestConfigMap
+		getCurrentRotation = orgGetCurrentRotation
+		doRollout = orgDoRollout
+		doRemove = orgDoRemove
+	}()
+	newCfg := func() *k8s.ConfigMap {
+		data, _ := blueGreenData([]*BlueGreenRotation{{StatefulSet: "db", Previous: "db---2", Current: "db---3"}})
+		data[manifestKey] = blueGreenManifest
+		return &k8s.ConfigMap{Data: data}
+	}
+	getManifestConfigMap = func(ctx context.Context, name, namespace string) (*k8s.ConfigMap, error) {
+		return newCfg(), nil
+	}
+	getCurrentRotation = func(ctx context.Context, name, namespace string) *currentRotations {
+		return nil
+	}
+	applied := map[string]k8s.Resource{}
+	doRollout = func(ctx context.Context, item k8s.Resource, options ...k8s.OperationOption) error {
+		applied[item.GetObjectKind().GroupVersionKind().Kind+item.GetName()] = item
+		return nil
+	}
+	var removed []string
+	doRemove = func(ctx context.Context, name, namespace string, kind k8s.Kind, options ...k8s.OperationOption) error {
+		removed = append(removed, name)
+		return nil
+	}
+	rc := global.NewContext(context.Background(), global.WithNamespace("ns"), global.WithLogLevel(logrus.ErrorLevel))
+
+	assert.NoError(t, Promote(rc, "db"))
+	assert.Equal(t, []string{"db---2"}, removed)
+	assert.NotContains(t, applied[k8s.KindConfigMap].(*k8s.ConfigMap).Data, blueGreenKey)
+
+	removed = nil
+	applied = map[string]k8s.Resource{}
+	assert.NoError(t, Abort(rc, "db"))
+	assert.Equal(t, []string{"db---3"}, removed)
+	assert.Equal(t, "db---2", selectorOf(t, applied[k8s.KindService+"db"])[realNameLabel])
+	assert.NotContains(t, applied, k8s.KindService+"other")
+	assert.NotContains(t, applied[k8s.KindConfigMap].(*k8s.ConfigMap).Data, blueGreenKey)
+}
+
+func TestBlueGreenThenPlainRollout(t *testing.T) {
+	orgGetManifestConfigMap := getManifestConfigMap
+	orgGetLive := getLive
+	orgListStatefulSets := listStatefulSets
+	orgGetStatefulSet := getStatefulSet
+	orgDoRollout := doRollout
+	orgDoRemove := doRemove
+	defer func() {
+		getManifestConfigMap = orgGetManifestConfigMap
+		getLive = orgGetLive
+		listStatefulSets = orgListStatefulSets
+		getStatefulSet = orgGetStatefulSet
+		doRollout = orgDoRollout
+		doRemove = orgDoRemove
+	}()
+	live := map[string]k8s.Resource{}
+	notFound := func(kind k8s.Kind, name string) error {
+		return apierrors.NewNotFound(schema.GroupResource{Resource: kind}, name)
+	}
+	doRollout = func(ctx context.Context, item k8s.Resource, options ...k8s.OperationOption) error {
+		live[resourceKey(item.GetObjectKind().GroupVersionKind().Kind, item.GetName())] = item
+		return nil
+	}
+	doRemove = func(ctx context.Context, name, namespace string, kind k8s.Kind, options ...k8s.OperationOption) error {
+		delete(live, resourceKey(kind, name))
+		return nil
+	}
+	getManifestConfigMap = func(ctx context.Context, name, namespace string) (*k8s.ConfigMap, error) {
+		if r, ok := live[resourceKey(k8s.KindConfigMap, name+"-manifest")]; ok {
+			return k8s.Parse[*k8s.ConfigMap](r)
+		}
+		return nil, notFound(k8s.KindConfigMap, name+"-manifest")
+	}
+	readySts := func(r k8s.Resource) (*k8s.StatefulSet, error) {
+		sts, err := k8s.Parse[*k8s.StatefulSet](r)
+		if err == nil {
+			sts.Status.ReadyReplicas, sts.Status.AvailableReplicas, sts.Status.UpdatedReplicas = 1, 1, 1
+		}
+		return sts, err
+	}
+	getLive = func(ctx context.Context, kind k8s.Kind, name, namespace string) (k8s.Resource, error) {
+		r, ok := live[resourceKey(kind, name)]
+		if !ok {
+			return nil, notFound(kind, name)
+		}
+		switch kind {
+		case k8s.KindStatefulSet:
+			return readySts(r)
+		case k8s.KindService:
+			return k8s.Parse[*k8s.Service](r)
+		}
+		return r, nil
+	}
+	getStatefulSet = func(ctx context.Context, name, namespace string) (*k8s.StatefulSet, error) {
+		if r, ok := live[resourceKey(k8s.KindStatefulSet, name)]; ok {
+			return readySts(r)
+		}
+		return nil, notFound(k8s.KindStatefulSet, name)
+	}
+	listStatefulSets = func(ctx context.Context, namespace string, pattern *regexp.Regexp) ([]*k8s.StatefulSet, error) {
+		var stss []*k8s.StatefulSet
+		for _, r := range live {
+			if r.GetObjectKind().GroupVersionKind().Kind != k8s.KindStatefulSet || !pattern.MatchString(r.GetName()) {
+				continue
+			}
+			sts, err := readySts(r)
+			if err != nil {
+				return nil, err
+			}
+			stss = append(stss, sts)
+		}
+		return stss, nil
+	}
+	chart := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(chart, "Chart.yaml"), []byte("apiVersion: v2\nname: db\nversion: 0.1.0\n"), 0o644))
+	assert.NoError(t, os.Mkdir(filepath.Join(chart, "templates"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(chart, "templates", "db.yaml"), []byte(`
+kind: StatefulSet
+apiVersion: apps/v1
+metadata:
+  name: db
+spec:
+  serviceName: {{ .Values.serviceName }}
+  template:
+    metadata:
+      labels:
+        app: db
+    spec:
+      containers:
+      - name: db
+        image: app:1
+---
+kind: Service
+apiVersion: v1
+metadata:
+  name: db
+spec:
+  selector:
+    app: db`), 0o644))
+	values := func(serviceName string) map[string]any {
+		return map[string]any{"global": map[string]any{"name": "db", "namespace": "ns"}, "serviceName": serviceName}
+	}
+	rc := global.NewContext(context.Background(), global.WithNamespace("ns"), global.WithLogLevel(logrus.ErrorLevel))
+	wait := WithWait(10 * time.Millisecond)
+	liveStss := func() []string {
+		var names []string
+		for key, r := range live {
+			if strings.HasPrefix(key, k8s.KindStatefulSet) {
+				names = append(names, r.GetName())
+			}
+		}
+		slices.Sort(names)
+		return names
+	}
+
+	assert.NoError(t, Rollout(rc, chart, values("a"), WithBlueGreen(0), wait))
+	assert.NoError(t, Rollout(rc, chart, values("b"), WithBlueGreen(0), wait))
+	assert.Equal(t, []string{"db---0", "db---1"}, liveStss())
+	assert.Equal(t, "db---1", selectorOf(t, live[resourceKey(k8s.KindService, "db")])[realNameLabel])
+
+	assert.NoError(t, Rollout(rc, chart, values("c"), wait))
+	assert.Equal(t, []string{"db---2"}, liveStss())
+	assert.Equal(t, "db---2", selectorOf(t, live[resourceKey(k8s.KindService, "db")])[realNameLabel])
+}
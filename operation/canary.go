@@ -0,0 +1,174 @@
+package operation
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nextbillion-ai/goreman-util/global"
+	"github.com/zhchang/goquiver/k8s"
+)
+
+// CanarySuffix is appended to the name of a Deployment to name its canary.
+const CanarySuffix = "-canary"
+
+// LabelCanary marks the pods of a canary Deployment. The selector of the canary requires it, so the
+// canary does not count the pods of the Deployment it is a copy of. The selector of that Deployment
+// still matches the pods of the canary: while the canary runs, the HorizontalPodAutoscalers and
+// PodDisruptionBudgets targeting the Deployment count them along with its own pods.
+const LabelCanary = "foreman/canary"
+
+// DefaultCanaryTimeout is how long a canary is given to become ready when no wait is set.
+const DefaultCanaryTimeout = 10 * time.Minute
+
+// CanaryCheck is a custom health gate run once a canary is ready. Returning an error aborts the
+// canary rollout.
+type CanaryCheck func(rc global.ResourceContext, canary *k8s.Deployment) error
+
+// Canary is the canary of a Deployment.
+//
+// Fields:
+// Deployment: The name of the Deployment in the manifest.
+// Canary: The name of the canary Deployment.
+// Replicas: The replicas of the canary.
+// Promoted: Whether the canary passed the health gate and the Deployment was updated.
+// Err: Why the canary was aborted, nil when promoted.
+type Canary struct {
+	Deployment string
+	Canary     string
+	Replicas   int32
+	Promoted   bool
+	Err        error
+}
+
+// WithCanary makes Rollout update changed Deployments through a canary: a copy named
+// `<name>-canary` running the new version with percent of the replicas of the Deployment (at least
+// one) is created next to it and receives its share of the traffic of the Services selecting both.
+// Once the canaries are ready (within the wait, DefaultCanaryTimeout when not set) and pass check,
+// if any, the Deployments are updated and the canaries removed. Otherwise the canaries are removed,
+// the Deployments are left untouched and Rollout fails. See LabelCanary for how the canaries share
+// the HorizontalPodAutoscalers and PodDisruptionBudgets of their Deployments.
+func WithCanary(percent int, check CanaryCheck) OperationOption {
+	return func(opts *operationOptions) {
+		opts.canary = &canary{percent: percent, check: check}
+	}
+}
+
+type canary struct {
+	percent int
+	check   CanaryCheck
+}
+
+func (c *canary) validate() error {
+	if c.percent < 1 || c.percent > 100 {
+		return fmt.Errorf("canary percent must be between 1 and 100, got %d", c.percent)
+	}
+	return nil
+}
+
+// replicas returns the replicas of the canary of a Deployment with the given replicas.
+func (c *canary) replicas(replicas *int32) int32 {
+	total := int32(1)
+	if replicas != nil {
+		total = *replicas
+	}
+	share := (total*int32(c.percent) + 99) / 100
+	return max(share, 1)
+}
+
+// build returns the canary of the Deployment r.
+func (c *canary) build(r k8s.Resource) (*k8s.Deployment, error) {
+	deployment, err := k8s.Parse[*k8s.Deployment](r)
+	if err != nil {
+		return nil, err
+	}
+	canary := deployment.DeepCopy()
+	canary.Kind = k8s.KindDeployment
+	canary.Name = deployment.GetName() + CanarySuffix
+	replicas := c.replicas(deployment.Spec.Replicas)
+	canary.Spec.Replicas = &replicas
+	if canary.Spec.Selector != nil {
+		canary.Spec.Selector.MatchLabels = mergeStringMap(canary.Spec.Selector.MatchLabels, map[string]string{LabelCanary: "true"})
+	}
+	canary.Spec.Template.Labels = mergeStringMap(canary.Spec.Template.Labels, map[string]string{LabelCanary: "true"})
+	return canary, nil
+}
+
+// run applies the canaries of deployments and gates them. On the first failure every canary is
+// removed and the error returned.
+func (c *canary) run(rc global.ResourceContext, deployments []k8s.Resource, opts *operationOptions, owner *ownership) error {
+	timeout := opts.wait
+	if timeout <= 0 {
+		timeout = DefaultCanaryTimeout
+	}
+	var canaries []*Canary
+	var err error
+	for _, r := range deployments {
+		var deployment *k8s.Deployment
+		if deployment, err = c.build(r); err != nil {
+			break
+		}
+		result := &Canary{Deployment: r.GetName(), Canary: deployment.GetName(), Replicas: *deployment.Spec.Replicas}
+		canaries = append(canaries, result)
+		if deployment.Namespace == "" {
+			deployment.Namespace = rc.Namespace()
+		}
+		var stamped k8s.Resource
+		if stamped, err = owner.stamp(deployment); err == nil {
+			err = applyObject(rc, stamped, opts)
+		}
+		if err == nil {
+			rc.Logger().Infof("canary %s created with %d replica(s)", result.Canary, result.Replicas)
+			err = c.gate(rc, deployment, timeout)
+		}
+		if err != nil {
+			result.Err = err
+			break
+		}
+	}
+	for _, result := range canaries {
+		result.Promoted = err == nil
+	}
+	if err != nil {
+		for _, result := range canaries {
+			rc.Logger().Warnf("aborting canary %s: %s", result.Canary, err)
+			opts.remove(rc, k8s.KindDeployment, result.Canary, rc.Namespace(), timeout)
+		}
+	}
+	opts.result.Canaries = append(opts.result.Canaries, canaries...)
+	if err != nil {
+		return fmt.Errorf("canary rollout aborted: %w", err)
+	}
+	return nil
+}
+
+// gate waits for the canary to be ready and runs the custom check.
+func (c *canary) gate(rc global.ResourceContext, deployment *k8s.Deployment, timeout time.Duration) error {
+	if err := waitReady(rc.Context(), k8s.KindDeployment, deployment.GetName(), deployment.GetNamespace(), timeout); err != nil {
+		return fmt.Errorf("canary %s is not ready: %w", deployment.GetName(), err)
+	}
+	if c.check == nil {
+		return nil
+	}
+	if err := c.check(rc, deployment); err != nil {
+		return fmt.Errorf("canary %s failed its check: %w", deployment.GetName(), err)
+	}
+	return nil
+}
+
+// promote removes the canaries once their Deployments are updated and ready, or the wait is over.
+func (c *canary) promote(rc global.ResourceContext, opts *operationOptions) {
+	timeout := opts.wait
+	if timeout <= 0 {
+		timeout = DefaultCanaryTimeout
+	}
+	for _, result := range opts.result.Canaries {
+		if !result.Promoted {
+			continue
+		}
+		if err := waitReady(rc.Context(), k8s.KindDeployment, result.Deployment, rc.Namespace(), timeout); err != nil {
+			rc.Logger().Warnf("deployment %s is not ready, removing canary %s anyway: %s", result.Deployment, result.Canary, err)
+		}
+		rc.Logger().Infof("promoted canary %s", result.Canary)
+		opts.remove(rc, k8s.KindDeployment, result.Canary, rc.Namespace(), 0)
+	}
+}
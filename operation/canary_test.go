@@ -0,0 +1,170 @@
+package operation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nextbillion-ai/goreman-util/global"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhchang/goquiver/k8s"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const canaryManifest = `
+kind: Deployment
+apiVersion: apps/v1
+metadata:
+  name: web
+spec:
+  replicas: 10
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+---
+kind: Deployment
+apiVersion: apps/v1
+metadata:
+  name: worker
+spec:
+  selector:
+    matchLabels:
+      app: worker
+  template:
+    metadata:
+      labels:
+        app: worker
+---
+kind: Service
+apiVersion: v1
+metadata:
+  name: web
+spec:
+  selector:
+    app: web
+---
+kind: ConfigMap
+apiVersion: v1
+metadata:
+  name: web-config
+data:
+  mode: new`
+
+func TestCanaryReplicas(t *testing.T) {
+	replicas := func(n int32) *int32 { return &n }
+	assert.Equal(t, int32(1), (&canary{percent: 10}).replicas(nil))
+	assert.Equal(t, int32(1), (&canary{percent: 10}).replicas(replicas(3)))
+	assert.Equal(t, int32(3), (&canary{percent: 25}).replicas(replicas(10)))
+	assert.Equal(t, int32(10), (&canary{percent: 100}).replicas(replicas(10)))
+	assert.Error(t, (&canary{percent: 0}).validate())
+	assert.Error(t, (&canary{percent: 101}).validate())
+}
+
+func TestCanarySelectors(t *testing.T) {
+	list, err := k8s.DecodeAllYAML(canaryManifest + `
+---
+kind: PodDisruptionBudget
+apiVersion: policy/v1
+metadata:
+  name: web
+spec:
+  minAvailable: 9
+  selector:
+    matchLabels:
+      app: web`)
+	assert.NoError(t, err)
+	web, err := k8s.Parse[*k8s.Deployment](list[0])
+	assert.NoError(t, err)
+	pdb, err := k8s.Parse[*k8s.PodDisruptionBudget](list[4])
+	assert.NoError(t, err)
+	canary, err := (&canary{percent: 10}).build(web)
+	assert.NoError(t, err)
+	selects := func(selector *metav1.LabelSelector, podLabels map[string]string) bool {
+		s, err := metav1.LabelSelectorAsSelector(selector)
+		assert.NoError(t, err)
+		return s.Matches(labels.Set(podLabels))
+	}
+	assert.False(t, selects(canary.Spec.Selector, web.Spec.Template.Labels))
+	assert.True(t, selects(canary.Spec.Selector, canary.Spec.Template.Labels))
+	// the Deployment, and so its HorizontalPodAutoscalers, and its PodDisruptionBudgets count the canary pods
+	assert.True(t, selects(web.Spec.Selector, canary.Spec.Template.Labels))
+	assert.True(t, selects(pdb.Spec.Selector, canary.Spec.Template.Labels))
+}
+
+func TestCanaryRollout(t *testing.T) {
+	orgGetLive := getLive
+	orgDoRollout := doRollout
+	orgDoRemove := doRemove
+	defer func() {
+		getLive = orgGetLive
+		doRollout = orgDoRollout
+		doRemove = orgDoRemove
+	}()
+	getLive = func(ctx context.Context, kind k8s.Kind, name, namespace string) (k8s.Resource, error) {
+		deployment := &k8s.Deployment{}
+		deployment.Status.ReadyReplicas, deployment.Status.AvailableReplicas, deployment.Status.UpdatedReplicas = 1, 1, 1
+		if name == "web-canary" {
+			deployment.Status.ReadyReplicas, deployment.Status.AvailableReplicas, deployment.Status.UpdatedReplicas = 3, 3, 3
+		}
+		deployment.Spec.Replicas = &deployment.Status.ReadyReplicas
+		return deployment, nil
+	}
+	var steps []string
+	var canaries []*k8s.Deployment
+	doRollout = func(ctx context.Context, item k8s.Resource, options ...k8s.OperationOption) error {
+		steps = append(steps, "apply "+item.GetName())
+		if deployment, err := k8s.Parse[*k8s.Deployment](item); err == nil && item.GetName() == "web-canary" {
+			canaries = append(canaries, deployment)
+		}
+		return nil
+	}
+	doRemove = func(ctx context.Context, name, namespace string, kind k8s.Kind, options ...k8s.OperationOption) error {
+		steps = append(steps, "remove "+name)
+		return nil
+	}
+	rc := global.NewContext(context.Background(), global.WithNamespace("ns"), global.WithLogLevel(logrus.ErrorLevel))
+	changed := map[string]bool{
+		resourceKey(k8s.KindDeployment, "web"):       true,
+		resourceKey(k8s.KindDeployment, "worker"):    false,
+		resourceKey(k8s.KindService, "web"):          false,
+		resourceKey(k8s.KindConfigMap, "web-config"): true,
+	}
+	owner := &ownership{name: "app"}
+
+	list, err := k8s.DecodeAllYAML(canaryManifest)
+	assert.NoError(t, err)
+	checked := 0
+	opts := &operationOptions{wait: time.Second, result: &Result{}}
+	WithCanary(25, func(rc global.ResourceContext, canary *k8s.Deployment) error {
+		checked++
+		return nil
+	})(opts)
+	assert.NoError(t, apply(rc, list, nil, opts, changed, owner))
+	assert.Equal(t, []string{"apply web-config", "apply web-canary", "apply web", "remove web-canary"}, steps)
+	assert.Equal(t, 1, checked)
+	assert.Equal(t, []*Canary{{Deployment: "web", Canary: "web-canary", Replicas: 3, Promoted: true}}, opts.result.Canaries)
+	assert.Equal(t, "true", canaries[0].Spec.Selector.MatchLabels[LabelCanary])
+	assert.Equal(t, "true", canaries[0].Spec.Template.Labels[LabelCanary])
+	assert.Equal(t, "ns", canaries[0].Namespace)
+	assert.Equal(t, "app", canaries[0].Labels[LabelResource])
+
+	steps = nil
+	list, err = k8s.DecodeAllYAML(canaryManifest)
+	assert.NoError(t, err)
+	opts = &operationOptions{wait: time.Second, result: &Result{}}
+	WithCanary(25, func(rc global.ResourceContext, canary *k8s.Deployment) error {
+		return errors.New("error rate too high")
+	})(opts)
+	err = apply(rc, list, []toRemove{{kind: k8s.KindConfigMap, name: "old"}}, opts, changed, owner)
+	assert.ErrorContains(t, err, "error rate too high")
+	assert.Equal(t, []string{"apply web-config", "apply web-canary", "remove web-canary"}, steps)
+	assert.False(t, opts.result.Canaries[0].Promoted)
+	assert.Error(t, opts.result.Canaries[0].Err)
+}
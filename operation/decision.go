@@ -0,0 +1,202 @@
+package operation
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/nextbillion-ai/goreman-util/global"
+	"github.com/zhchang/goquiver/k8s"
+	"github.com/zhchang/goquiver/raw"
+)
+
+// Where the rotation flag of a StatefulSet comes from.
+const (
+	RotationFlagAnnotation = "annotation"
+	RotationFlagBlacklist  = "blacklist"
+	RotationFlagDefault    = "default"
+)
+
+// RotationDecision explains whether a StatefulSet is rotated by a rollout.
+//
+// Fields:
+// StatefulSet: The name of the StatefulSet in the manifest.
+// Rotate: Whether a new rotation is created instead of updating the current one in place.
+// Reason: Why the StatefulSet is or is not rotated.
+// Paths: The changed spec paths that trigger the rotation, e.g. spec.volumeClaimTemplates[0].
+// RotationEnabled, FlagSource: Whether rotation is enabled for the StatefulSet, and whether this comes
+// from the rotation annotation, the image blacklist or the default.
+// Current: The live rotation, empty if the StatefulSet was never rotated.
+// Next: The rotation that is created, if Rotate.
+type RotationDecision struct {
+	StatefulSet     string
+	Rotate          bool
+	Reason          string
+	Paths           []string
+	RotationEnabled bool
+	FlagSource      string
+	Current         string
+	Next            string
+}
+
+// rotationFlag reports whether rotation is enabled for sts and where this comes from.
+func rotationFlag(policy *global.RotationPolicy, sts *k8s.StatefulSet) (enabled bool, source string) {
+	if flag := sts.ObjectMeta.Annotations[policy.AnnotationKey]; flag != "" {
+		return flag == "enabled", RotationFlagAnnotation
+	}
+	for _, c := range sts.Spec.Template.Spec.Containers {
+		if policy.Blacklisted(c.Image) {
+			return false, RotationFlagBlacklist
+		}
+	}
+	return true, RotationFlagDefault
+}
+
+// diffPaths returns the sorted paths of the changes in df, a result of raw.Diff, below prefix.
+func diffPaths(prefix string, df any) []string {
+	m, ok := df.(map[string]any)
+	if !ok || len(m) == 0 {
+		return []string{prefix}
+	}
+	var paths []string
+	for key, value := range m {
+		switch key {
+		case "":
+			paths = append(paths, prefix)
+		case "array":
+			if indexes, ok := value.(map[string]any); ok {
+				for index := range indexes {
+					paths = append(paths, fmt.Sprintf("%s[%s]", prefix, index))
+				}
+				continue
+			}
+			fallthrough
+		default:
+			paths = append(paths, diffPaths(prefix+"."+key, value)...)
+		}
+	}
+	slices.Sort(paths)
+	return slices.Compact(paths)
+}
+
+// decideRotation decides whether sts, changed as described by df, must be rotated.
+func decideRotation(policy *global.RotationPolicy, df raw.Map, sts *k8s.StatefulSet) *RotationDecision {
+	d := &RotationDecision{StatefulSet: sts.GetName()}
+	d.RotationEnabled, d.FlagSource = rotationFlag(policy, sts)
+	if len(df) == 0 {
+		d.Reason = "no changes"
+		return d
+	}
+	specMap, err := raw.Get[raw.Map](df, "spec")
+	if err != nil {
+		d.Reason = "no spec changes"
+		return d
+	}
+	if !d.RotationEnabled {
+		d.Reason = "rotation disabled by " + d.FlagSource
+		return d
+	}
+	specChanges := make([]string, 0, len(specMap))
+	for k := range specMap {
+		specChanges = append(specChanges, k)
+	}
+	slices.Sort(specChanges)
+	if !policy.SingleReplicaInPlace && sts.Spec.Replicas != nil && *sts.Spec.Replicas == 1 {
+		if len(specChanges) == 1 && specChanges[0] == "replicas" {
+			d.Reason = "only replicas changed"
+			return d
+		}
+		d.Rotate, d.Reason, d.Paths = true, "spec changed on a single-replica StatefulSet", diffPaths("spec", specMap)
+		return d
+	}
+	for _, key := range specChanges {
+		if !policy.InPlace(key) {
+			d.Rotate, d.Reason = true, "spec changes that can not be updated in place"
+			d.Paths = append(d.Paths, diffPaths("spec."+key, specMap[key])...)
+		}
+	}
+	if d.Rotate {
+		return d
+	}
+	if templateMap, err := raw.ChainGet[raw.Map](df, "spec", "template"); err == nil {
+		if labels, ok := templateMap["labels"]; ok {
+			d.Rotate, d.Reason, d.Paths = true, "pod template labels changed", diffPaths("spec.template.labels", labels)
+			return d
+		}
+	}
+	d.Reason = "spec changes are updated in place"
+	return d
+}
+
+// planRotation decides the rotation of the StatefulSet old, changed as described by df, and fills
+// in its current and next rotation.
+func planRotation(rc global.ResourceContext, policy *global.RotationPolicy, old k8s.Resource, df raw.Map) (*RotationDecision, error) {
+	sts, err := k8s.Parse[*k8s.StatefulSet](old)
+	if err != nil {
+		return nil, err
+	}
+	d := decideRotation(policy, df, sts)
+	if current := getCurrentRotation(rc.Context(), sts.GetName(), rc.Namespace()); current != nil {
+		if err = d.setRotations(sts.GetName(), current); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// setRotations fills in the current rotation of the StatefulSet name and, if it is rotated, the next
+// one.
+func (d *RotationDecision) setRotations(name string, current *currentRotations) error {
+	d.Current = current.names[len(current.names)-1]
+	if !d.Rotate {
+		return nil
+	}
+	next, err := current.next()
+	if err != nil {
+		return err
+	}
+	d.Next = name + "---" + strconv.Itoa(next)
+	return nil
+}
+
+// Plan renders the chart like Rollout and returns, without changing anything, whether and why every
+// StatefulSet of the recorded manifest would be rotated.
+func Plan(rc global.ResourceContext, chartPath string, values raw.Map, options ...OperationOption) ([]*RotationDecision, error) {
+	opts := &operationOptions{}
+	for _, opt := range options {
+		opt(opts)
+	}
+	policy := opts.rotationPolicy(rc)
+	var err error
+	if err = policy.Validate(); err != nil {
+		return nil, err
+	}
+	var old, new []k8s.Resource
+	if old, new, _, _, err = getManifests(rc.Context(), chartPath, values); err != nil {
+		return nil, err
+	}
+	if new, _, _, err = splitHooks(new); err != nil {
+		return nil, err
+	}
+	newMap := indexResources(new)
+	var decisions []*RotationDecision
+	for _, r := range withoutHooks(old) {
+		if r.GetObjectKind().GroupVersionKind().Kind != k8s.KindStatefulSet {
+			continue
+		}
+		nr, ok := newMap[resourceKey(k8s.KindStatefulSet, r.GetName())]
+		if !ok {
+			continue
+		}
+		var df raw.Map
+		if df, err = raw.Diff(r, *nr); err != nil {
+			df = nil
+		}
+		var decision *RotationDecision
+		if decision, err = planRotation(rc, policy, r, df); err != nil {
+			return nil, err
+		}
+		decisions = append(decisions, decision)
+	}
+	return decisions, nil
+}
@@ -0,0 +1,126 @@
+package operation
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/nextbillion-ai/goreman-util/global"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhchang/goquiver/k8s"
+	"github.com/zhchang/goquiver/raw"
+)
+
+func TestDecideRotation(t *testing.T) {
+	parse := func(doc string) *k8s.StatefulSet {
+		r, err := k8s.DecodeYAML(doc)
+		assert.NoError(t, err)
+		sts, err := k8s.Parse[*k8s.StatefulSet](r)
+		assert.NoError(t, err)
+		return sts
+	}
+	old := parse(`
+kind: StatefulSet
+apiVersion: apps/v1
+metadata:
+  name: db
+spec:
+  replicas: 2
+  volumeClaimTemplates:
+  - metadata:
+      name: data
+    spec:
+      resources:
+        requests:
+          storage: 1Gi
+  template:
+    spec:
+      containers:
+      - image: app:1`)
+	changed := parse(`
+kind: StatefulSet
+apiVersion: apps/v1
+metadata:
+  name: db
+spec:
+  replicas: 3
+  volumeClaimTemplates:
+  - metadata:
+      name: data
+    spec:
+      resources:
+        requests:
+          storage: 2Gi
+  template:
+    spec:
+      containers:
+      - image: app:2`)
+	policy := global.DefaultRotationPolicy()
+	df, err := raw.Diff(old, changed)
+	assert.NoError(t, err)
+
+	d := decideRotation(policy, df, old)
+	assert.True(t, d.Rotate)
+	assert.Equal(t, "spec changes that can not be updated in place", d.Reason)
+	assert.Equal(t, []string{"spec.volumeClaimTemplates[0]"}, d.Paths)
+	assert.True(t, d.RotationEnabled)
+	assert.Equal(t, RotationFlagDefault, d.FlagSource)
+
+	delete(df["spec"].(raw.Map), "volumeClaimTemplates")
+	d = decideRotation(policy, df, old)
+	assert.False(t, d.Rotate)
+	assert.Equal(t, "spec changes are updated in place", d.Reason)
+	assert.Empty(t, d.Paths)
+
+	old.Annotations = map[string]string{global.DefaultRotationAnnotation: "disabled"}
+	d = decideRotation(policy, df, old)
+	assert.False(t, d.Rotate)
+	assert.Equal(t, "rotation disabled by annotation", d.Reason)
+
+	old.Annotations = nil
+	old.Spec.Template.Spec.Containers[0].Image = "redis:7"
+	d = decideRotation(policy, df, old)
+	assert.Equal(t, RotationFlagBlacklist, d.FlagSource)
+	assert.False(t, d.RotationEnabled)
+
+	one := int32(1)
+	old.Spec.Template.Spec.Containers[0].Image = "app:1"
+	old.Spec.Replicas = &one
+	d = decideRotation(policy, df, old)
+	assert.True(t, d.Rotate)
+	assert.Equal(t, []string{"spec.replicas", "spec.template.spec.containers[0]"}, d.Paths)
+
+	assert.Equal(t, "no changes", decideRotation(policy, nil, old).Reason)
+}
+
+func TestPlanRotation(t *testing.T) {
+	org := getCurrentRotation
+	defer func() {
+		getCurrentRotation = org
+	}()
+	getCurrentRotation = func(ctx context.Context, name, namespace string) *currentRotations {
+		return &currentRotations{rotation: 9, names: []string{"db---8", "db---9"}}
+	}
+	r, err := k8s.DecodeYAML(`
+kind: StatefulSet
+apiVersion: apps/v1
+metadata:
+  name: db
+spec:
+  replicas: 2`)
+	assert.NoError(t, err)
+	rc := global.NewContext(context.Background())
+	d, err := planRotation(rc, global.RotationPolicyOf(rc), r, raw.Map{"spec": raw.Map{"serviceName": "db2"}})
+	assert.NoError(t, err)
+	assert.True(t, d.Rotate)
+	assert.Equal(t, []string{"spec.serviceName"}, d.Paths)
+	assert.Equal(t, "db---9", d.Current)
+	assert.Equal(t, "db---10", d.Next)
+
+	getCurrentRotation = func(ctx context.Context, name, namespace string) *currentRotations {
+		return &currentRotations{rotation: math.MaxInt, names: []string{"db---" + strconv.Itoa(math.MaxInt)}}
+	}
+	_, err = planRotation(rc, global.RotationPolicyOf(rc), r, raw.Map{"spec": raw.Map{"serviceName": "db2"}})
+	assert.ErrorContains(t, err, "cannot be incremented")
+}
@@ -0,0 +1,236 @@
+package operation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/nextbillion-ai/goreman-util/global"
+	"github.com/zhchang/goquiver/k8s"
+	"github.com/zhchang/goquiver/raw"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+type DriftStatus string
+
+const (
+	DriftInSync   DriftStatus = "InSync"
+	DriftModified DriftStatus = "Modified"
+	DriftMissing  DriftStatus = "Missing"
+)
+
+// DriftItem reports the drift of one object of the stored manifest.
+//
+// Fields:
+// Kind, Name: The object as recorded in the manifest.
+// LiveName: The name of the live object, which differs from Name for rotated StatefulSets.
+// Status: Whether the live object matches the manifest, was modified or is missing.
+// Diff: The raw.Diff between the recorded and the live object, restricted to the recorded fields.
+// Fixed: Whether the recorded object was re-applied (fix mode only).
+// Err: The error met while checking or fixing the object, if any.
+type DriftItem struct {
+	Kind     k8s.Kind
+	Name     string
+	LiveName string
+	Status   DriftStatus
+	Diff     raw.Map
+	Fixed    bool
+	Err      error
+}
+
+// DriftReport lists the drift of every object of a stored manifest.
+type DriftReport struct {
+	Items []*DriftItem
+}
+
+// Drifted reports whether any object was modified or is missing.
+func (r *DriftReport) Drifted() bool {
+	for _, item := range r.Items {
+		if item.Status != DriftInSync {
+			return true
+		}
+	}
+	return false
+}
+
+var doRollout = func(ctx context.Context, item k8s.Resource, options ...k8s.OperationOption) error {
+	return k8s.Rollout(ctx, item, options...)
+}
+
+// liveName resolves the name of the live object recorded as name in the manifest.
+func liveName(ctx context.Context, kind k8s.Kind, name, namespace string) string {
+	if kind == k8s.KindStatefulSet {
+		if current := getCurrentRotation(ctx, name, namespace); current != nil {
+			return name + "---" + strconv.Itoa(current.rotation)
+		}
+	}
+	return name
+}
+
+// DetectDrift compares every object recorded in the manifest of the named resource with its live
+// counterpart. Only the fields present in the manifest are compared, so fields defaulted or managed
+// by the server are ignored. With WithFix, modified and missing objects are re-applied from the manifest.
+func DetectDrift(rc global.ResourceContext, name string, options ...OperationOption) (*DriftReport, error) {
+	opts := &operationOptions{}
+	for _, opt := range options {
+		opt(opts)
+	}
+	var err error
+	var recorded []k8s.Resource
+	if recorded, err = getExistingManifest(rc.Context(), name, rc.Namespace()); err != nil {
+		return nil, err
+	}
+	recorded = withoutHooks(recorded)
+	report := &DriftReport{}
+	realNames := map[string]string{}
+	for _, r := range recorded {
+		if kind := r.GetObjectKind().GroupVersionKind().Kind; kind == k8s.KindStatefulSet {
+			realNames[r.GetName()] = liveName(rc.Context(), kind, r.GetName(), rc.Namespace())
+		}
+	}
+	for _, r := range recorded {
+		kind := r.GetObjectKind().GroupVersionKind().Kind
+		item := &DriftItem{Kind: kind, Name: r.GetName(), LiveName: liveName(rc.Context(), kind, r.GetName(), rc.Namespace())}
+		report.Items = append(report.Items, item)
+		var live k8s.Resource
+		if live, err = getLive(rc.Context(), kind, item.LiveName, rc.Namespace()); err != nil {
+			if !apierrors.IsNotFound(err) {
+				item.Err = err
+				continue
+			}
+			item.Status = DriftMissing
+			continue
+		}
+		if kind != k8s.KindStatefulSet {
+			if r, _, err = retarget(r, realNames); err != nil {
+				item.Err = err
+				continue
+			}
+		}
+		if item.Diff, err = driftDiff(r, live); err != nil {
+			item.Err = err
+			continue
+		}
+		item.Status = DriftInSync
+		if len(item.Diff) > 0 {
+			item.Status = DriftModified
+		}
+	}
+	if !opts.fix {
+		return report, nil
+	}
+	for index, item := range report.Items {
+		if item.Err != nil || item.Status == DriftInSync {
+			continue
+		}
+		var fixed k8s.Resource
+		if fixed, err = liveObject(recorded[index], realNames); err == nil {
+			err = doRollout(rc.Context(), fixed)
+		}
+		if err != nil {
+			rc.Logger().Warnf("failed to fix drift of %s/%s: %s", item.Kind, item.LiveName, err)
+			item.Err = err
+			continue
+		}
+		rc.Logger().Infof("fixed drift of %s/%s", item.Kind, item.LiveName)
+		item.Fixed = true
+	}
+	return report, nil
+}
+
+// liveObject turns a recorded object into the object that is actually applied, i.e. with
+// StatefulSets renamed to their rotation and references to them retargeted.
+func liveObject(r k8s.Resource, realNames map[string]string) (k8s.Resource, error) {
+	switch r.GetObjectKind().GroupVersionKind().Kind {
+	case k8s.KindStatefulSet:
+		sts, err := k8s.Parse[*k8s.StatefulSet](r)
+		if err != nil {
+			return nil, err
+		}
+		if realName := realNames[sts.GetName()]; realName != sts.GetName() {
+			setRotationName(sts, realName)
+		}
+		return sts, nil
+	default:
+		r, _, err := retarget(r, realNames)
+		return r, err
+	}
+}
+
+func toRawMap(obj any) (raw.Map, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	m := raw.Map{}
+	if err = json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// driftDiff diffs a recorded object with its live counterpart, ignoring type meta, status,
+// server-managed metadata and the name of rotated StatefulSets. References to rotated StatefulSets
+// must be retargeted in recorded beforehand.
+func driftDiff(recorded, live k8s.Resource) (raw.Map, error) {
+	kind := recorded.GetObjectKind().GroupVersionKind().Kind
+	var err error
+	var rm, lm raw.Map
+	if rm, err = toRawMap(recorded); err != nil {
+		return nil, err
+	}
+	if lm, err = toRawMap(live); err != nil {
+		return nil, err
+	}
+	delete(rm, "apiVersion")
+	delete(rm, "kind")
+	delete(rm, "status")
+	if metadata, ok := rm["metadata"].(raw.Map); ok {
+		for _, key := range []string{"namespace", "resourceVersion", "uid", "generation", "creationTimestamp", "managedFields", "selfLink"} {
+			delete(metadata, key)
+		}
+		if kind == k8s.KindStatefulSet {
+			delete(metadata, "name")
+		}
+	}
+	return raw.Diff(rm, project(rm, lm))
+}
+
+// project restricts live to the shape of recorded: fields only present in live are dropped and
+// scalars that only differ by representation (e.g. 1 and "1") are considered equal.
+func project(recorded, live any) any {
+	switch r := recorded.(type) {
+	case raw.Map:
+		l, ok := live.(raw.Map)
+		if !ok {
+			return live
+		}
+		p := raw.Map{}
+		for key, value := range r {
+			if lv, ok := l[key]; ok {
+				p[key] = project(value, lv)
+			}
+		}
+		return p
+	case raw.Slice:
+		l, ok := live.(raw.Slice)
+		if !ok {
+			return live
+		}
+		p := make(raw.Slice, len(l))
+		for i := range l {
+			if i < len(r) {
+				p[i] = project(r[i], l[i])
+			} else {
+				p[i] = l[i]
+			}
+		}
+		return p
+	default:
+		if recorded != nil && live != nil && fmt.Sprint(recorded) == fmt.Sprint(live) {
+			return recorded
+		}
+		return live
+	}
+}
@@ -0,0 +1,130 @@
+package operation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nextbillion-ai/goreman-util/global"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhchang/goquiver/k8s"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestDetectDrift(t *testing.T) {
+	var manifest = `
+kind: StatefulSet
+apiVersion: apps/v1
+metadata:
+  name: sts1
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - image: app:1
+        resources:
+          limits:
+            cpu: 1
+---
+kind: Service
+apiVersion: v1
+metadata:
+  name: svc1
+spec:
+  ports:
+  - port: 80
+---
+kind: ConfigMap
+apiVersion: v1
+metadata:
+  name: cfg1
+data:
+  key: value`
+	var live = map[string]string{
+		k8s.KindStatefulSet + "sts1---3": `
+kind: StatefulSet
+apiVersion: apps/v1
+metadata:
+  name: sts1---3
+  resourceVersion: "42"
+  labels:
+    app.kubernetes.io/realname: sts1---3
+spec:
+  replicas: 2
+  podManagementPolicy: OrderedReady
+  template:
+    spec:
+      containers:
+      - image: app:1
+        imagePullPolicy: IfNotPresent
+        resources:
+          limits:
+            cpu: "1"
+status:
+  replicas: 2`,
+		k8s.KindService + "svc1": `
+kind: Service
+apiVersion: v1
+metadata:
+  name: svc1
+spec:
+  clusterIP: 10.0.0.1
+  ports:
+  - port: 8080
+    protocol: TCP`,
+	}
+	orgGetExistingManifest := getExistingManifest
+	orgGetCurrentRotation := getCurrentRotation
+	orgGetLive := getLive
+	orgDoRollout := doRollout
+	defer func() {
+		getExistingManifest = orgGetExistingManifest
+		getCurrentRotation = orgGetCurrentRotation
+		getLive = orgGetLive
+		doRollout = orgDoRollout
+	}()
+	getExistingManifest = func(ctx context.Context, name, namespace string) ([]k8s.Resource, error) {
+		return k8s.DecodeAllYAML(manifest)
+	}
+	getCurrentRotation = func(ctx context.Context, name, namespace string) *currentRotations {
+		return &currentRotations{rotation: 3, names: []string{"sts1---3"}}
+	}
+	getLive = func(ctx context.Context, kind k8s.Kind, name, namespace string) (k8s.Resource, error) {
+		if doc, ok := live[kind+name]; ok {
+			return k8s.DecodeYAML(doc)
+		}
+		return nil, apierrors.NewNotFound(schema.GroupResource{Resource: kind}, name)
+	}
+	applied := map[string]bool{}
+	doRollout = func(ctx context.Context, item k8s.Resource, options ...k8s.OperationOption) error {
+		applied[item.GetName()] = true
+		return nil
+	}
+
+	rc := global.NewContext(context.Background(), global.WithNamespace("ns"), global.WithLogLevel(logrus.ErrorLevel))
+	report, err := DetectDrift(rc, "whocares")
+	assert.NoError(t, err)
+	assert.True(t, report.Drifted())
+	assert.Len(t, report.Items, 3)
+
+	sts := report.Items[0]
+	assert.Equal(t, "sts1---3", sts.LiveName)
+	assert.Equal(t, DriftInSync, sts.Status, "%+v", sts.Diff)
+
+	svc := report.Items[1]
+	assert.Equal(t, DriftModified, svc.Status)
+	assert.Contains(t, svc.Diff, "spec")
+
+	cfg := report.Items[2]
+	assert.Equal(t, DriftMissing, cfg.Status)
+	assert.Empty(t, applied)
+
+	report, err = DetectDrift(rc, "whocares", WithFix())
+	assert.NoError(t, err)
+	assert.False(t, report.Items[0].Fixed)
+	assert.True(t, report.Items[1].Fixed)
+	assert.True(t, report.Items[2].Fixed)
+	assert.Equal(t, map[string]bool{"svc1": true, "cfg1": true}, applied)
+}
@@ -0,0 +1,193 @@
+package operation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nextbillion-ai/goreman-util/global"
+	"github.com/nextbillion-ai/goreman-util/internal/kube"
+	"github.com/zhchang/goquiver/k8s"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Hooks are Jobs of a chart annotated with AnnotationHook. They are not applied with the other
+// objects: pre-rollout hooks run before the objects are applied and abort the rollout when they
+// fail, post-rollout hooks run once the manifest is recorded. A hook Job is recreated on every
+// rollout, waited on for AnnotationHookTimeout (DefaultHookTimeout when unset) and its logs are
+// written to the logger of the ResourceContext.
+const (
+	AnnotationHook        = "foreman/hook"
+	AnnotationHookTimeout = "foreman/hook-timeout"
+
+	HookPreRollout  = "pre-rollout"
+	HookPostRollout = "post-rollout"
+
+	DefaultHookTimeout = 5 * time.Minute
+)
+
+var hookPollInterval = time.Second
+
+func annotation(r k8s.Resource, key string) string {
+	meta, err := apimeta.Accessor(r)
+	if err != nil {
+		return ""
+	}
+	return meta.GetAnnotations()[key]
+}
+
+func isHook(r k8s.Resource) bool {
+	return annotation(r, AnnotationHook) != ""
+}
+
+// splitHooks separates the pre-rollout and post-rollout hooks from the other objects of list.
+func splitHooks(list []k8s.Resource) (objects, pre, post []k8s.Resource, err error) {
+	for _, r := range list {
+		phase := annotation(r, AnnotationHook)
+		if phase == "" {
+			objects = append(objects, r)
+			continue
+		}
+		if kind := r.GetObjectKind().GroupVersionKind().Kind; kind != k8s.KindJob {
+			return nil, nil, nil, fmt.Errorf("hook %s/%s must be a %s", kind, r.GetName(), k8s.KindJob)
+		}
+		switch phase {
+		case HookPreRollout:
+			pre = append(pre, r)
+		case HookPostRollout:
+			post = append(post, r)
+		default:
+			return nil, nil, nil, fmt.Errorf("hook %s has unknown phase %s", r.GetName(), phase)
+		}
+	}
+	return
+}
+
+// withoutHooks returns the objects of list that are not hooks.
+func withoutHooks(list []k8s.Resource) []k8s.Resource {
+	var objects []k8s.Resource
+	for _, r := range list {
+		if !isHook(r) {
+			objects = append(objects, r)
+		}
+	}
+	return objects
+}
+
+func hookTimeout(r k8s.Resource) (time.Duration, error) {
+	value := annotation(r, AnnotationHookTimeout)
+	if value == "" {
+		return DefaultHookTimeout, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s of hook %s: %w", AnnotationHookTimeout, r.GetName(), err)
+	}
+	return timeout, nil
+}
+
+// waitJob waits until the named Job succeeds, fails or timeout elapses.
+func waitJob(ctx context.Context, name, namespace string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		live, err := getLive(ctx, k8s.KindJob, name, namespace)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		if job, ok := live.(*k8s.Job); ok {
+			if job.Status.Succeeded > 0 {
+				return nil
+			}
+			for _, c := range job.Status.Conditions {
+				if c.Type == "Failed" && c.Status == corev1.ConditionTrue {
+					return fmt.Errorf("job %s failed: %s", name, c.Message)
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("job %s did not complete within %s", name, timeout)
+		case <-time.After(hookPollInterval):
+		}
+	}
+}
+
+// jobLogs returns the logs of the pods of the named Job. Pods are selected by the uid of the Job
+// since pods of a previous run of the hook may have been orphaned.
+var jobLogs = func(ctx context.Context, name, namespace string) (string, error) {
+	var err error
+	var client kubernetes.Interface
+	if client, err = kube.Clientset(); err != nil {
+		return "", err
+	}
+	var job *batchv1.Job
+	if job, err = client.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{}); err != nil {
+		return "", err
+	}
+	var pods *corev1.PodList
+	if pods, err = client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: "controller-uid=" + string(job.UID)}); err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for _, pod := range pods.Items {
+		for _, c := range pod.Spec.Containers {
+			var logs []byte
+			if logs, err = client.CoreV1().Pods(namespace).GetLogs(pod.Name, &corev1.PodLogOptions{Container: c.Name}).DoRaw(ctx); err != nil {
+				return sb.String(), err
+			}
+			sb.Write(logs)
+		}
+	}
+	return sb.String(), nil
+}
+
+// runHook recreates the hook Job, waits for it and logs its output.
+func runHook(rc global.ResourceContext, phase string, hook k8s.Resource, owner *ownership) error {
+	var err error
+	var timeout time.Duration
+	if timeout, err = hookTimeout(hook); err != nil {
+		return err
+	}
+	if hook, err = owner.stamp(hook); err != nil {
+		return err
+	}
+	name, namespace := hook.GetName(), hook.GetNamespace()
+	if err = doRemove(rc.Context(), name, namespace, k8s.KindJob, k8s.WithWait(timeout)); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("%s hook %s: %w", phase, name, err)
+	}
+	rc.Logger().Infof("running %s hook %s", phase, name)
+	if err = doRollout(rc.Context(), hook); err == nil {
+		err = waitJob(rc.Context(), name, namespace, timeout)
+	}
+	logs, logErr := jobLogs(rc.Context(), name, namespace)
+	if logErr != nil {
+		rc.Logger().Warnf("failed to get logs of %s hook %s: %s", phase, name, logErr)
+	}
+	for _, line := range strings.Split(strings.TrimRight(logs, "\n"), "\n") {
+		if line != "" {
+			rc.Logger().Infof("[%s] %s", name, line)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s hook %s: %w", phase, name, err)
+	}
+	return nil
+}
+
+// runHooks runs hooks one at a time in apply order and stops at the first failure.
+func runHooks(rc global.ResourceContext, phase string, hooks []k8s.Resource, owner *ownership) error {
+	sortForApply(hooks)
+	for _, hook := range hooks {
+		if err := runHook(rc, phase, hook, owner); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package operation
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nextbillion-ai/goreman-util/global"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhchang/goquiver/k8s"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestSplitHooks(t *testing.T) {
+	list, err := k8s.DecodeAllYAML(`
+kind: Job
+apiVersion: batch/v1
+metadata:
+  name: migrate
+  annotations:
+    foreman/hook: pre-rollout
+---
+kind: Deployment
+apiVersion: apps/v1
+metadata:
+  name: api
+---
+kind: Job
+apiVersion: batch/v1
+metadata:
+  name: smoke
+  annotations:
+    foreman/hook: post-rollout`)
+	assert.NoError(t, err)
+	objects, pre, post, err := splitHooks(list)
+	assert.NoError(t, err)
+	assert.Len(t, objects, 1)
+	assert.Equal(t, "migrate", pre[0].GetName())
+	assert.Equal(t, "smoke", post[0].GetName())
+	assert.Len(t, withoutHooks(list), 1)
+
+	bad, err := k8s.DecodeAllYAML(`
+kind: ConfigMap
+apiVersion: v1
+metadata:
+  name: cfg
+  annotations:
+    foreman/hook: pre-rollout`)
+	assert.NoError(t, err)
+	_, _, _, err = splitHooks(bad)
+	assert.ErrorContains(t, err, "must be a Job")
+}
+
+func TestRunHooks(t *testing.T) {
+	orgDoRemove := doRemove
+	orgDoRollout := doRollout
+	orgGetLive := getLive
+	orgJobLogs := jobLogs
+	orgHookPollInterval := hookPollInterval
+	defer func() {
+		doRemove = orgDoRemove
+		doRollout = orgDoRollout
+		getLive = orgGetLive
+		jobLogs = orgJobLogs
+		hookPollInterval = orgHookPollInterval
+	}()
+	hookPollInterval = time.Millisecond
+	var events []string
+	doRemove = func(ctx context.Context, name, namespace string, kind k8s.Kind, options ...k8s.OperationOption) error {
+		events = append(events, "remove "+name)
+		return apierrors.NewNotFound(schema.GroupResource{Resource: kind}, name)
+	}
+	doRollout = func(ctx context.Context, item k8s.Resource, options ...k8s.OperationOption) error {
+		events = append(events, "create "+item.GetName())
+		assert.Equal(t, "api", item.(*unstructured.Unstructured).GetLabels()[LabelResource])
+		return nil
+	}
+	polls := 0
+	getLive = func(ctx context.Context, kind k8s.Kind, name, namespace string) (k8s.Resource, error) {
+		job := &k8s.Job{}
+		switch name {
+		case "first":
+			if polls++; polls > 2 {
+				job.Status.Succeeded = 1
+			}
+		case "second":
+			job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "BackoffLimitExceeded"}}
+		}
+		return job, nil
+	}
+	jobLogs = func(ctx context.Context, name, namespace string) (string, error) {
+		return "migrating " + name + "\n", nil
+	}
+	hooks, err := k8s.DecodeAllYAML(`
+kind: Job
+apiVersion: batch/v1
+metadata:
+  name: second
+  annotations:
+    foreman/hook: pre-rollout
+    foreman/apply-weight: "1"
+---
+kind: Job
+apiVersion: batch/v1
+metadata:
+  name: first
+  annotations:
+    foreman/hook: pre-rollout
+---
+kind: Job
+apiVersion: batch/v1
+metadata:
+  name: third
+  annotations:
+    foreman/hook: pre-rollout
+    foreman/apply-weight: "2"`)
+	assert.NoError(t, err)
+	var out bytes.Buffer
+	rc := global.NewContext(context.Background(), global.WithLogLevel(logrus.InfoLevel))
+	rc.Logger().SetOutput(&out)
+
+	err = runHooks(rc, HookPreRollout, hooks, &ownership{name: "api"})
+	assert.ErrorContains(t, err, "pre-rollout hook second: job second failed: BackoffLimitExceeded")
+	assert.Equal(t, []string{"remove first", "create first", "remove second", "create second"}, events)
+	assert.Contains(t, out.String(), "[first] migrating first")
+	assert.Contains(t, out.String(), "[second] migrating second")
+
+	getLive = func(ctx context.Context, kind k8s.Kind, name, namespace string) (k8s.Resource, error) {
+		return &k8s.Job{}, nil
+	}
+	timeout, err := k8s.DecodeYAML(`
+kind: Job
+apiVersion: batch/v1
+metadata:
+  name: slow
+  annotations:
+    foreman/hook: post-rollout
+    foreman/hook-timeout: 10ms`)
+	assert.NoError(t, err)
+	err = runHooks(rc, HookPostRollout, []k8s.Resource{timeout}, &ownership{name: "api"})
+	assert.ErrorContains(t, err, "did not complete within 10ms")
+}
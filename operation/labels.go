@@ -0,0 +1,170 @@
+package operation
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/zhchang/goquiver/k8s"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Labels identifying what goreman-util manages. They are set on the manifest ConfigMap of every
+// resource and can be used in the selector passed to List.
+const (
+	LabelManagedBy    = "app.kubernetes.io/managed-by"
+	LabelResource     = "foreman/resource"
+	LabelAssetType    = "foreman/asset-type"
+	LabelAssetRelease = "foreman/asset-release"
+
+	// ManagedByValue is the value of LabelManagedBy on objects managed by goreman-util.
+	ManagedByValue = "goreman"
+)
+
+var invalidLabelChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// labelValue turns s into a valid label value: invalid characters are replaced with '-', the value is
+// truncated to 63 characters and must start and end with an alphanumeric character.
+func labelValue(s string) string {
+	s = invalidLabelChars.ReplaceAllString(s, "-")
+	if len(s) > 63 {
+		s = s[:63]
+	}
+	return strings.TrimFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	})
+}
+
+// ownerLabels returns the ownership labels of the named resource.
+func ownerLabels(name string, record *Record) map[string]string {
+	labels := map[string]string{
+		LabelManagedBy: ManagedByValue,
+		LabelResource:  labelValue(name),
+	}
+	if record != nil {
+		if record.AssetType != "" {
+			labels[LabelAssetType] = labelValue(record.AssetType)
+		}
+		if record.AssetRelease != "" {
+			labels[LabelAssetRelease] = labelValue(record.AssetRelease)
+		}
+	}
+	return labels
+}
+
+// Annotations describing the rollout that last applied an object.
+const (
+	AnnotationRolloutID  = "foreman/rollout-id"
+	AnnotationValuesHash = "foreman/values-hash"
+)
+
+// ownership describes the goreman resource a rollout applies objects for.
+type ownership struct {
+	name   string
+	record *Record
+}
+
+func (o *ownership) labels() map[string]string {
+	return ownerLabels(o.name, o.record)
+}
+
+func (o *ownership) annotations() map[string]string {
+	annotations := map[string]string{}
+	if o.record != nil {
+		if o.record.RolloutID != "" {
+			annotations[AnnotationRolloutID] = o.record.RolloutID
+		}
+		if o.record.ValuesHash != "" {
+			annotations[AnnotationValuesHash] = o.record.ValuesHash
+		}
+	}
+	return annotations
+}
+
+func toUnstructured(r k8s.Resource) (*unstructured.Unstructured, error) {
+	if u, ok := r.(*unstructured.Unstructured); ok {
+		return u, nil
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(r)
+	if err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: content}, nil
+}
+
+func mergeStringMap(dst, src map[string]string) map[string]string {
+	if dst == nil {
+		dst = map[string]string{}
+	}
+	for key, value := range src {
+		dst[key] = value
+	}
+	return dst
+}
+
+// stampTemplate adds labels to the metadata of the pod template found at path, if any.
+func stampTemplate(u *unstructured.Unstructured, labels map[string]string, path ...string) error {
+	if _, found, err := unstructured.NestedMap(u.Object, path...); err != nil || !found {
+		return err
+	}
+	labelsPath := append(append([]string{}, path...), "metadata", "labels")
+	existing, _, err := unstructured.NestedStringMap(u.Object, labelsPath...)
+	if err != nil {
+		return err
+	}
+	return unstructured.SetNestedStringMap(u.Object, mergeStringMap(existing, labels), labelsPath...)
+}
+
+// templateLabels returns the ownership labels that never change between rollouts, the only ones set
+// on pod templates.
+func (o *ownership) templateLabels() map[string]string {
+	return map[string]string{
+		LabelManagedBy: ManagedByValue,
+		LabelResource:  labelValue(o.name),
+	}
+}
+
+// stamp sets the ownership labels and annotations on r and the stable ownership labels on its pod
+// templates. The asset and rollout specific ones are kept off pod templates so that a new release
+// does not restart pods by itself.
+func (o *ownership) stamp(r k8s.Resource) (k8s.Resource, error) {
+	u, err := toUnstructured(r)
+	if err != nil {
+		return nil, err
+	}
+	u.SetLabels(mergeStringMap(u.GetLabels(), o.labels()))
+	u.SetAnnotations(mergeStringMap(u.GetAnnotations(), o.annotations()))
+	labels := o.templateLabels()
+	if err = stampTemplate(u, labels, "spec", "template"); err != nil {
+		return nil, err
+	}
+	if err = stampTemplate(u, labels, "spec", "jobTemplate"); err != nil {
+		return nil, err
+	}
+	if err = stampTemplate(u, labels, "spec", "jobTemplate", "spec", "template"); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// checkOwner refuses to overwrite a live object that belongs to another goreman resource.
+func (o *ownership) checkOwner(ctx context.Context, r k8s.Resource) error {
+	kind := r.GetObjectKind().GroupVersionKind().Kind
+	live, err := getLive(ctx, kind, r.GetName(), r.GetNamespace())
+	if err != nil {
+		// missing objects and kinds that can not be fetched have no owner to conflict with
+		return nil
+	}
+	var meta metav1.Object
+	if meta, err = apimeta.Accessor(live); err != nil {
+		return nil
+	}
+	if owner, ok := meta.GetLabels()[LabelResource]; ok && owner != labelValue(o.name) {
+		return fmt.Errorf("%s %s/%s is owned by goreman resource %s", kind, r.GetNamespace(), r.GetName(), owner)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package operation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhchang/goquiver/k8s"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestStamp(t *testing.T) {
+	owner := &ownership{name: "api", record: &Record{AssetType: "service", AssetRelease: "v1.2+3", ValuesHash: "abc", RolloutID: "r1"}}
+
+	deploy, err := k8s.DecodeYAML(`
+kind: Deployment
+apiVersion: apps/v1
+metadata:
+  name: api
+  labels:
+    app: api
+spec:
+  template:
+    metadata:
+      labels:
+        app: api
+    spec:
+      containers:
+      - image: app:1`)
+	assert.NoError(t, err)
+	stamped, err := owner.stamp(deploy)
+	assert.NoError(t, err)
+	u := stamped.(*unstructured.Unstructured)
+	assert.Equal(t, "api", u.GetLabels()["app"])
+	assert.Equal(t, ManagedByValue, u.GetLabels()[LabelManagedBy])
+	assert.Equal(t, "v1.2-3", u.GetLabels()[LabelAssetRelease])
+	assert.Equal(t, map[string]string{AnnotationRolloutID: "r1", AnnotationValuesHash: "abc"}, u.GetAnnotations())
+	podLabels, _, _ := unstructured.NestedStringMap(u.Object, "spec", "template", "metadata", "labels")
+	assert.Equal(t, "api", podLabels["app"])
+	assert.Equal(t, "api", podLabels[LabelResource])
+	assert.Equal(t, ManagedByValue, podLabels[LabelManagedBy])
+	assert.NotContains(t, podLabels, LabelAssetRelease)
+	assert.NotContains(t, podLabels, LabelAssetType)
+	_, found, _ := unstructured.NestedMap(u.Object, "spec", "template", "metadata", "annotations")
+	assert.False(t, found)
+
+	cron := &k8s.CronJob{}
+	cron.APIVersion, cron.Kind, cron.Name = "batch/v1", k8s.KindCronJob, "job"
+	stamped, err = owner.stamp(cron)
+	assert.NoError(t, err)
+	u = stamped.(*unstructured.Unstructured)
+	assert.Equal(t, k8s.KindCronJob, u.GetKind())
+	podLabels, _, _ = unstructured.NestedStringMap(u.Object, "spec", "jobTemplate", "spec", "template", "metadata", "labels")
+	assert.Equal(t, "api", podLabels[LabelResource])
+	assert.NotContains(t, podLabels, LabelAssetRelease)
+
+	cfg := &k8s.ConfigMap{}
+	cfg.APIVersion, cfg.Kind, cfg.Name = "v1", k8s.KindConfigMap, "cfg"
+	stamped, err = owner.stamp(cfg)
+	assert.NoError(t, err)
+	_, found, _ = unstructured.NestedMap(stamped.(*unstructured.Unstructured).Object, "spec")
+	assert.False(t, found)
+}
+
+func TestCheckOwner(t *testing.T) {
+	orgGetLive := getLive
+	defer func() {
+		getLive = orgGetLive
+	}()
+	getLive = func(ctx context.Context, kind k8s.Kind, name, namespace string) (k8s.Resource, error) {
+		svc := &k8s.Service{}
+		switch name {
+		case "mine":
+			svc.Labels = map[string]string{LabelResource: "api"}
+		case "theirs":
+			svc.Labels = map[string]string{LabelResource: "worker"}
+		case "missing":
+			return nil, apierrors.NewNotFound(schema.GroupResource{Resource: kind}, name)
+		}
+		return svc, nil
+	}
+	owner := &ownership{name: "api"}
+	for name, conflict := range map[string]bool{"mine": false, "theirs": true, "missing": false, "unlabeled": false} {
+		svc := &k8s.Service{}
+		svc.Kind, svc.Name = k8s.KindService, name
+		err := owner.checkOwner(context.Background(), svc)
+		if conflict {
+			assert.ErrorContains(t, err, "owned by goreman resource worker", name)
+		} else {
+			assert.NoError(t, err, name)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package operation
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/zhchang/goquiver/k8s"
+)
+
+func getTyped[T k8s.Resource](ctx context.Context, name, namespace string) (k8s.Resource, error) {
+	r, err := k8s.Get[T](ctx, name, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// getLive fetches the live object of the given kind from the cluster.
+var getLive = func(ctx context.Context, kind k8s.Kind, name, namespace string) (k8s.Resource, error) {
+	switch kind {
+	case k8s.KindDeployment:
+		return getTyped[*k8s.Deployment](ctx, name, namespace)
+	case k8s.KindStatefulSet:
+		return getTyped[*k8s.StatefulSet](ctx, name, namespace)
+	case k8s.KindConfigMap:
+		return getTyped[*k8s.ConfigMap](ctx, name, namespace)
+	case k8s.KindCronJob:
+		return getTyped[*k8s.CronJob](ctx, name, namespace)
+	case k8s.KindService:
+		return getTyped[*k8s.Service](ctx, name, namespace)
+	case k8s.KindIngress:
+		return getTyped[*k8s.Ingress](ctx, name, namespace)
+	case k8s.KindPodDisruptionBudget:
+		return getTyped[*k8s.PodDisruptionBudget](ctx, name, namespace)
+	case k8s.KindSecret:
+		return getTyped[*k8s.Secret](ctx, name, namespace)
+	case k8s.KindStorageClass:
+		return getTyped[*k8s.StorageClass](ctx, name, namespace)
+	case k8s.KindPersistentVolumeClaim:
+		return getTyped[*k8s.PersistentVolumeClaim](ctx, name, namespace)
+	case k8s.KindPersistentVolume:
+		return getTyped[*k8s.PersistentVolume](ctx, name, namespace)
+	case k8s.KindCustomResourceDefinition:
+		return getTyped[*k8s.CustomResourceDefinition](ctx, name, namespace)
+	case k8s.KindServiceAccount:
+		return getTyped[*k8s.ServiceAccount](ctx, name, namespace)
+	case k8s.KindClusterRole:
+		return getTyped[*k8s.ClusterRole](ctx, name, namespace)
+	case k8s.KindClusterRoleBinding:
+		return getTyped[*k8s.ClusterRoleBinding](ctx, name, namespace)
+	case k8s.KindRole:
+		return getTyped[*k8s.Role](ctx, name, namespace)
+	case k8s.KindRoleBinding:
+		return getTyped[*k8s.RoleBinding](ctx, name, namespace)
+	case k8s.KindDaemonSet:
+		return getTyped[*k8s.DaemonSet](ctx, name, namespace)
+	case k8s.KindPod:
+		return getTyped[*k8s.Pod](ctx, name, namespace)
+	case k8s.KindJob:
+		return getTyped[*k8s.Job](ctx, name, namespace)
+	case k8s.KindHorizontalPodAutoscaler:
+		return getTyped[*k8s.HorizontalPodAutoscaler](ctx, name, namespace)
+	default:
+		return nil, fmt.Errorf("[get] unsupported kind: %s", kind)
+	}
+}
@@ -11,11 +11,13 @@ import (
 	"cmp"
 	"context"
 	"fmt"
+	"math"
 	"regexp"
 	"slices"
 	"strconv"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/nextbillion-ai/goreman-util/global"
 	"github.com/zhchang/goquiver/k8s"
 	"github.com/zhchang/goquiver/raw"
@@ -26,6 +28,8 @@ type toRemove struct {
 	name      string
 	namespace string
 	kind      k8s.Kind
+	// weight is the apply weight of the object, see AnnotationApplyWeight.
+	weight int
 }
 
 func resourceKey(kind, name string) string {
@@ -35,10 +39,10 @@ func resourceKey(kind, name string) string {
 var getExistingManifest = func(ctx context.Context, name, namespace string) (existing []k8s.Resource, err error) {
 	var _t []k8s.Resource
 	var cfg *k8s.ConfigMap
-	if cfg, err = k8s.Get[*k8s.ConfigMap](ctx, name+"-manifest", namespace); err != nil {
+	if cfg, err = getManifestConfigMap(ctx, name, namespace); err != nil {
 		return
 	}
-	if _t, err = k8s.DecodeAllYAML(cfg.Data["manifest"]); err == nil {
+	if _t, err = k8s.DecodeAllYAML(cfg.Data[manifestKey]); err == nil {
 		existing = _t
 		return
 	}
@@ -59,86 +63,32 @@ func getManifests(ctx context.Context, chartPath string, values raw.Map) (old []
 	if old, err = getExistingManifest(ctx, name, namespace); err != nil {
 		old = nil
 	}
-	newMap = map[string]*k8s.Resource{}
-	for _, r := range new {
-		newMap[resourceKey(r.GetObjectKind().GroupVersionKind().Kind, r.GetName())] = &r
-	}
+	newMap = indexResources(new)
 	err = nil
 	return
 }
 
-var blackLists = []*regexp.Regexp{regexp.MustCompile(`^(docker.io\/)*redis`), regexp.MustCompile(`^(docker.io\/)*postgres`)}
-
-func shouldRename(sts *k8s.StatefulSet) bool {
-	var rotationFlag = ""
-	if sts.ObjectMeta.Annotations != nil {
-		rotationFlag = sts.ObjectMeta.Annotations["foreman/rotation"]
-	}
-	var hasRotationBlacklist = false
-	for _, c := range sts.Spec.Template.Spec.Containers {
-		for _, bl := range blackLists {
-			if bl.MatchString(c.Image) {
-				hasRotationBlacklist = true
-				break
-			}
-		}
-		if hasRotationBlacklist {
-			break
-		}
-	}
-	if rotationFlag == "" {
-		if hasRotationBlacklist {
-			rotationFlag = "disabled"
-		} else {
-			rotationFlag = "enabled"
-		}
+// indexResources maps the objects of list by resourceKey. The values point into list, so that
+// replacing an object through the map replaces it in list.
+func indexResources(list []k8s.Resource) map[string]*k8s.Resource {
+	index := map[string]*k8s.Resource{}
+	for i, r := range list {
+		index[resourceKey(r.GetObjectKind().GroupVersionKind().Kind, r.GetName())] = &list[i]
 	}
-	return rotationFlag == "enabled"
+	return index
 }
 
-var rotatekeys = map[string]struct{}{
-	"template":       {},
-	"replicas":       {},
-	"updateStrategy": {},
+func shouldRename(policy *global.RotationPolicy, sts *k8s.StatefulSet) bool {
+	enabled, _ := rotationFlag(policy, sts)
+	return enabled
 }
 
-func shouldRotate(rc global.ResourceContext, df raw.Map, sts *k8s.StatefulSet) bool {
-	if len(df) == 0 {
-		return false
-	}
-	var err error
-	var specMap raw.Map
-	if specMap, err = raw.Get[raw.Map](df, "spec"); err != nil {
-		return false
+func shouldRotate(rc global.ResourceContext, policy *global.RotationPolicy, df raw.Map, sts *k8s.StatefulSet) bool {
+	decision := decideRotation(policy, df, sts)
+	if decision.Rotate {
+		rc.Logger().Debugf("[rotate reason] %s: %+v", decision.Reason, decision.Paths)
 	}
-	if !shouldRename(sts) {
-		return false
-	}
-	specChanges := make([]string, 0, len(specMap))
-	for k := range specMap {
-		specChanges = append(specChanges, k)
-	}
-	if sts.Spec.Replicas != nil && *sts.Spec.Replicas == 1 {
-		if len(specChanges) == 1 && specChanges[0] == "replicas" {
-			return false
-		}
-		rc.Logger().Debugf("[rotate reason] spec changes with 1 replica sts: %+v", specChanges)
-		return true
-	}
-	for _, key := range specChanges {
-		if _, ok := rotatekeys[key]; !ok {
-			rc.Logger().Debugf("[rotate reason] must rotate spec change: %+v", key)
-			return true
-		}
-	}
-	var templateMap raw.Map
-	if templateMap, err = raw.ChainGet[raw.Map](df, "spec", "template"); err == nil {
-		if _, ok := templateMap["labels"]; ok {
-			rc.Logger().Debugf("[rotate reason] spec template labels changed")
-			return true
-		}
-	}
-	return false
+	return decision.Rotate
 }
 
 type currentRotations struct {
@@ -146,11 +96,10 @@ type currentRotations struct {
 	rotation int
 }
 
-var stsRotationRegex = regexp.MustCompile(`.*---(\d+)`)
+var stsRotationRegex = regexp.MustCompile(`^.+---(\d+)$`)
 
 func extractRotation(name string) (rotation int, err error) {
-	// Create a regular expression to find digits following the pattern .*---\d+
-	// Find the first submatch, which will include the entire match and the captured groups
+	// Find the digits following the last ---, the first submatch holds the captured digits
 	matches := stsRotationRegex.FindStringSubmatch(name)
 	if matches == nil || len(matches) < 2 {
 		err = fmt.Errorf("rotation not found")
@@ -160,28 +109,66 @@ func extractRotation(name string) (rotation int, err error) {
 	return
 }
 
+// next returns the number of the rotation following the current one.
+func (c *currentRotations) next() (int, error) {
+	if c.rotation == math.MaxInt {
+		return 0, fmt.Errorf("rotation number %d cannot be incremented", c.rotation)
+	}
+	return c.rotation + 1, nil
+}
+
+// rotationPattern matches the names of the rotations of the StatefulSet name, and only those.
+func rotationPattern(name string) *regexp.Regexp {
+	return regexp.MustCompile(`^` + regexp.QuoteMeta(name) + `---(\d+)$`)
+}
+
+var listStatefulSets = func(ctx context.Context, namespace string, pattern *regexp.Regexp) ([]*k8s.StatefulSet, error) {
+	return k8s.List[*k8s.StatefulSet](ctx, namespace, k8s.WithRegex(pattern))
+}
+
 var getCurrentRotation = func(ctx context.Context, name, namespace string) *currentRotations {
-	var stss []*k8s.StatefulSet
-	var err error
-	if stss, err = k8s.List[*k8s.StatefulSet](ctx, namespace, k8s.WithRegex(regexp.MustCompile(fmt.Sprintf(`%s---\d+`, name)))); err != nil {
+	stss, err := listStatefulSets(ctx, namespace, rotationPattern(name))
+	if err != nil {
 		return nil
 	}
-	if len(stss) == 0 {
-		return nil
+	return rotationsOf(name, stss)
+}
+
+// rotationsOf returns the rotations of the StatefulSet name found in stss, ordered by rotation
+// number, the last one being current. StatefulSets whose realname label is not their own name, or
+// whose rotation number does not fit an int, are not rotations of name.
+func rotationsOf(name string, stss []*k8s.StatefulSet) *currentRotations {
+	type rotation struct {
+		name   string
+		number int
 	}
-	slices.SortFunc[[]*k8s.StatefulSet](stss, func(a, b *k8s.StatefulSet) int {
-		return cmp.Compare[string](a.GetName(), b.GetName())
-	})
-	var rotation int
-	if rotation, err = extractRotation(stss[len(stss)-1].GetName()); err != nil {
+	pattern := rotationPattern(name)
+	var rotations []rotation
+	for _, sts := range stss {
+		matches := pattern.FindStringSubmatch(sts.GetName())
+		if matches == nil {
+			continue
+		}
+		if realName := getLabel(&sts.ObjectMeta, realNameLabel); realName != "" && realName != sts.GetName() {
+			continue
+		}
+		number, err := strconv.Atoi(matches[1])
+		if err != nil {
+			continue
+		}
+		rotations = append(rotations, rotation{name: sts.GetName(), number: number})
+	}
+	if len(rotations) == 0 {
 		return nil
 	}
-
+	slices.SortFunc(rotations, func(a, b rotation) int {
+		return cmp.Or(cmp.Compare(a.number, b.number), cmp.Compare(a.name, b.name))
+	})
 	r := &currentRotations{
-		rotation: rotation,
+		rotation: rotations[len(rotations)-1].number,
 	}
-	for _, sts := range stss {
-		r.names = append(r.names, sts.GetName())
+	for _, rotation := range rotations {
+		r.names = append(r.names, rotation.name)
 	}
 	return r
 }
@@ -202,28 +189,47 @@ func getLabel(meta *metav1.ObjectMeta, key string) string {
 	return meta.Labels[key]
 }
 
-func rotateSts(rc global.ResourceContext, old k8s.Resource, new *k8s.Resource, toRemoves *[]toRemove, df raw.Map) (rotated bool, err error) {
-	//var changed = len(df) > 0
+// setRotationName names sts after one of its rotations and points its realname labels at it.
+func setRotationName(sts *k8s.StatefulSet, name string) {
+	sts.ObjectMeta.Name = name
+	setLabel(&sts.ObjectMeta, realNameLabel, name)
+	setLabel(&sts.Spec.Template.ObjectMeta, realNameLabel, name)
+	if len(sts.Spec.Template.Spec.TopologySpreadConstraints) > 0 {
+		for _, tsc := range sts.Spec.Template.Spec.TopologySpreadConstraints {
+			tsc.LabelSelector.MatchLabels = map[string]string{
+				realNameLabel: name,
+			}
+		}
+	}
+}
+
+// rotateSts names new after the rotation of the StatefulSet old it replaces, queues the rotations
+// it makes obsolete for removal and returns the rotation decision it acted on.
+func rotateSts(rc global.ResourceContext, policy *global.RotationPolicy, old k8s.Resource, new *k8s.Resource, toRemoves *[]toRemove, df raw.Map) (decision *RotationDecision, err error) {
+	weight := applyWeight(old)
 	var sts *k8s.StatefulSet
 	if sts, err = k8s.Parse[*k8s.StatefulSet](old); err != nil {
 		return
 	}
-	sr := len(df) > 0 && shouldRotate(rc, df, sts)
+	decision = decideRotation(policy, df, sts)
+	if decision.Rotate {
+		rc.Logger().Debugf("[rotate reason] %s: %+v", decision.Reason, decision.Paths)
+	}
 	rc.Logger().Infof("trying to rotate manifest for %s/%s", sts.GetNamespace(), sts.GetName())
 	var current = getCurrentRotation(rc.Context(), sts.Name, rc.Namespace())
 	if current != nil {
 		rc.Logger().Infof(`current rotation for %s/%s is %d`, sts.GetNamespace(), sts.GetName(), current.rotation)
+		if err = decision.setRotations(sts.GetName(), current); err != nil {
+			return
+		}
 	}
-	var removeAll bool
 	var newStsName string = sts.GetName()
-	if sr {
+	if decision.Rotate {
 		if current == nil {
 			err = fmt.Errorf("no current rotation found.")
 			return
 		}
-		removeAll = true
-		newStsName = sts.GetName() + `---` + strconv.Itoa(current.rotation+1)
-		rotated = true
+		newStsName = decision.Next
 	} else if current != nil {
 		newStsName = sts.GetName() + `---` + strconv.Itoa(current.rotation)
 	}
@@ -231,24 +237,15 @@ func rotateSts(rc global.ResourceContext, old k8s.Resource, new *k8s.Resource, t
 	if newSts, err = k8s.Parse[*k8s.StatefulSet](*new); err != nil {
 		return
 	}
-	newSts.ObjectMeta.Name = newStsName
-	setLabel(&newSts.ObjectMeta, realNameLabel, newStsName)
-	setLabel(&newSts.Spec.Template.ObjectMeta, realNameLabel, newStsName)
-	if len(newSts.Spec.Template.Spec.TopologySpreadConstraints) > 0 {
-		for _, tsc := range newSts.Spec.Template.Spec.TopologySpreadConstraints {
-			tsc.LabelSelector.MatchLabels = map[string]string{
-				realNameLabel: newStsName,
-			}
-		}
-	}
+	setRotationName(newSts, newStsName)
 	if current != nil {
 		var removes []string = current.names[:len(current.names)-1]
-		if removeAll {
+		if decision.Rotate {
 			removes = current.names
 		}
 		ns := newSts.GetNamespace()
 		for _, remove := range removes {
-			*toRemoves = append(*toRemoves, toRemove{name: remove, namespace: ns, kind: k8s.KindStatefulSet})
+			*toRemoves = append(*toRemoves, toRemove{name: remove, namespace: ns, kind: k8s.KindStatefulSet, weight: weight})
 		}
 	}
 	rc.Logger().Infof(`applying rotation: %s`, newSts.GetName())
@@ -258,7 +255,20 @@ func rotateSts(rc global.ResourceContext, old k8s.Resource, new *k8s.Resource, t
 }
 
 type operationOptions struct {
-	wait time.Duration
+	wait           time.Duration
+	fix            bool
+	record         *Record
+	fieldManager   string
+	forceConflicts bool
+	neverPrune     []k8s.Kind
+	neverPruneSet  bool
+	confirmPrune   func(Orphan) bool
+	result         *Result
+	strictRemoval  bool
+	policy         *global.RotationPolicy
+	blueGreen      *blueGreen
+	dryRun         bool
+	canary         *canary
 }
 
 type OperationOption func(*operationOptions)
@@ -272,6 +282,28 @@ func WithWait(d time.Duration) OperationOption {
 	}
 }
 
+// WithFix makes DetectDrift re-apply the recorded manifest to the objects that drifted.
+func WithFix() OperationOption {
+	return func(opts *operationOptions) {
+		opts.fix = true
+	}
+}
+
+// WithRotationPolicy sets the StatefulSet rotation policy of a rollout, overriding the policy of the
+// ResourceContext. Unset fields of policy keep their default.
+func WithRotationPolicy(policy *global.RotationPolicy) OperationOption {
+	return func(opts *operationOptions) {
+		opts.policy = policy.WithDefaults()
+	}
+}
+
+func (opts *operationOptions) rotationPolicy(rc global.ResourceContext) *global.RotationPolicy {
+	if opts.policy != nil {
+		return opts.policy
+	}
+	return global.RotationPolicyOf(rc)
+}
+
 // Rollout applies a rolling update to the Kubernetes resources defined in the specified chart.
 // It compares the existing resources with the new resources and performs necessary updates.
 // The function takes a resource context, chart path, values, and optional operation options as parameters.
@@ -281,28 +313,58 @@ func Rollout(rc global.ResourceContext, chartPath string, values raw.Map, option
 	for _, opt := range options {
 		opt(opts)
 	}
+	if opts.result == nil {
+		opts.result = &Result{}
+	}
 	var err error
+	if err = opts.rotationPolicy(rc).Validate(); err != nil {
+		return err
+	}
+	if opts.canary != nil {
+		if err = opts.canary.validate(); err != nil {
+			return err
+		}
+	}
 	var old, new []k8s.Resource
 	var newMap map[string]*k8s.Resource
 	var newStr string
 	if old, new, newMap, newStr, err = getManifests(rc.Context(), chartPath, values); err != nil {
 		return err
 	}
+	var preHooks, postHooks []k8s.Resource
+	if new, preHooks, postHooks, err = splitHooks(new); err != nil {
+		return err
+	}
 	if len(new) == 0 {
 		return fmt.Errorf("nothing to rollout")
 	}
+	newMap = indexResources(new)
+	old = withoutHooks(old)
+	var name string
+	if name, err = raw.ChainGet[string](values, "global", "name"); err != nil {
+		return err
+	}
+	if opts.blueGreen != nil {
+		opts.blueGreen.load(rc, name)
+	}
 
 	var toRemoves []toRemove
 	var changed = map[string]bool{}
 
 	var rotated bool
+	var clones []*volumeClone
 	for _, r := range old {
 		kind := r.GetObjectKind().GroupVersionKind().Kind
 		key := resourceKey(kind, r.GetName())
 		var ok bool
 		var nr *k8s.Resource
 		if nr, ok = newMap[key]; !ok {
-			toRemoves = append(toRemoves, toRemove{name: r.GetName(), namespace: r.GetNamespace(), kind: kind})
+			if reason := opts.orphanReason(r); reason != "" {
+				rc.Logger().Warnf("%s %s/%s was removed from the chart but is kept: %s", kind, r.GetNamespace(), r.GetName(), reason)
+				opts.result.Orphans = append(opts.result.Orphans, Orphan{Kind: kind, Name: r.GetName(), Namespace: r.GetNamespace(), Reason: reason})
+				continue
+			}
+			toRemoves = append(toRemoves, toRemove{name: r.GetName(), namespace: r.GetNamespace(), kind: kind, weight: applyWeight(r)})
 			continue
 		}
 		var df raw.Map
@@ -312,10 +374,24 @@ func Rollout(rc global.ResourceContext, chartPath string, values raw.Map, option
 		changed[key] = len(df) > 0
 		rc.Logger().Debugf("%s changed: %t", key, changed[key])
 		if kind == k8s.KindStatefulSet {
-			var _rotated bool
-			if _rotated, err = rotateSts(rc, r, nr, &toRemoves, df); err != nil {
+			var decision *RotationDecision
+			if decision, err = rotateSts(rc, opts.rotationPolicy(rc), r, nr, &toRemoves, df); err != nil {
 				return err
 			}
+			opts.result.Rotations = append(opts.result.Rotations, decision)
+			_rotated := decision.Rotate
+			if _rotated && opts.blueGreen != nil {
+				opts.blueGreen.rotate(r.GetName(), (*nr).GetName())
+			}
+			if _rotated {
+				var clone *volumeClone
+				if clone, err = cloneFrom(*nr); err != nil {
+					return err
+				}
+				if clone != nil {
+					clones = append(clones, clone)
+				}
+			}
 			if !rotated && _rotated {
 				rotated = _rotated
 			}
@@ -324,84 +400,208 @@ func Rollout(rc global.ResourceContext, chartPath string, values raw.Map, option
 	if !rotated {
 		opts.wait = time.Duration(0)
 	}
-	if err = apply(rc, new, toRemoves, opts.wait, changed); err != nil {
+	for _, pending := range getPendingRemovals(rc.Context(), name, rc.Namespace()) {
+		if _, ok := newMap[resourceKey(pending.Kind, pending.Name)]; ok {
+			continue
+		}
+		if !slices.ContainsFunc(toRemoves, func(r toRemove) bool {
+			return r.kind == pending.Kind && r.name == pending.Name && r.namespace == pending.Namespace
+		}) {
+			rc.Logger().Infof("retrying removal of %s-%s/%s", pending.Kind, pending.Namespace, pending.Name)
+			toRemoves = append(toRemoves, toRemove{name: pending.Name, namespace: pending.Namespace, kind: pending.Kind})
+		}
+	}
+	if opts.blueGreen != nil {
+		toRemoves = opts.blueGreen.keep(rc, toRemoves)
+	}
+	record := &Record{}
+	if opts.record != nil {
+		*record = *opts.record
+	}
+	if record.RolloutID == "" {
+		record.RolloutID = uuid.NewString()
+	}
+	opts.result.RolloutID = record.RolloutID
+	owner := &ownership{name: name, record: record}
+	if err = runHooks(rc, HookPreRollout, preHooks, owner); err != nil {
 		return err
 	}
-	return writeManifest(rc.Context(), newStr, new[0].GetName(), rc.Namespace())
+	if err = opts.cloneVolumes(rc, clones); err != nil {
+		return err
+	}
+	if err = apply(rc, new, toRemoves, opts, changed, owner); err != nil {
+		return err
+	}
+	data := record.data()
+	var pending map[string]string
+	if pending, err = pendingRemovalsData(opts.result); err != nil {
+		return err
+	}
+	for key, value := range pending {
+		data[key] = value
+	}
+	if opts.blueGreen != nil {
+		if err = opts.blueGreen.cutover(rc, new, opts, owner); err != nil {
+			return err
+		}
+		opts.result.BlueGreen = opts.blueGreen.switches
+		if pending, err = blueGreenData(opts.blueGreen.rotations()); err != nil {
+			return err
+		}
+		for key, value := range pending {
+			data[key] = value
+		}
+	}
+	if err = writeManifest(rc.Context(), newStr, new[0].GetName(), rc.Namespace(), ownerLabels(name, record), data); err != nil {
+		return err
+	}
+	if err = opts.removalError(); err != nil {
+		return err
+	}
+	return runHooks(rc, HookPostRollout, postHooks, owner)
 }
 
-func writeManifest(ctx context.Context, value, name, namespace string) error {
+func writeManifest(ctx context.Context, value, name, namespace string, labels, data map[string]string) error {
 
 	var manifest k8s.ConfigMap
 	manifest.Kind = k8s.KindConfigMap
 	manifest.ObjectMeta.Name = name + "-manifest"
 	manifest.ObjectMeta.Namespace = namespace
+	manifest.ObjectMeta.Labels = labels
 	manifest.Data = map[string]string{
-		"manifest": value,
+		manifestKey: value,
+	}
+	for key, v := range data {
+		manifest.Data[key] = v
 	}
-	return k8s.Rollout(ctx, &manifest)
+	return doRollout(ctx, &manifest)
 }
 
-func renameStss(list []k8s.Resource, stsNameToRealName map[string]string) {
+func renameStss(policy *global.RotationPolicy, list []k8s.Resource, stsNameToRealName map[string]string) {
 	for index, r := range list {
 		kind := r.GetObjectKind().GroupVersionKind().Kind
 		if kind == k8s.KindStatefulSet {
 			//var sts *k8s.StatefulSet
 			sts, _ := k8s.Parse[*k8s.StatefulSet](r)
-			if !stsRotationRegex.MatchString(r.GetName()) && shouldRename(sts) {
+			if !stsRotationRegex.MatchString(r.GetName()) && shouldRename(policy, sts) {
 				org := sts.GetName()
-				sts.ObjectMeta.Name += "---0"
+				setRotationName(sts, org+"---0")
 				list[index] = sts
 				stsNameToRealName[org] = sts.ObjectMeta.Name
 			} else {
-				org := getLabel(&sts.ObjectMeta, "app.kubernetes.io/name")
-				stsNameToRealName[org] = getLabel(&sts.ObjectMeta, "app.kubernetes.io/realname")
+				if org := getLabel(&sts.ObjectMeta, "app.kubernetes.io/name"); org != "" {
+					stsNameToRealName[org] = getLabel(&sts.ObjectMeta, "app.kubernetes.io/realname")
+				}
+				if getLabel(&sts.Spec.Template.ObjectMeta, realNameLabel) == "" {
+					// not seen by rotateSts, its pods still need the label Services are pinned to
+					setRotationName(sts, sts.GetName())
+					list[index] = sts
+				}
 			}
 		}
 	}
 }
 
-func apply(rc global.ResourceContext, new []k8s.Resource, toRemoves []toRemove, wait time.Duration, changed map[string]bool) (err error) {
+func apply(rc global.ResourceContext, new []k8s.Resource, toRemoves []toRemove, opts *operationOptions, changed map[string]bool, owner *ownership) (err error) {
 	stsNameToRealName := map[string]string{}
-	renameStss(new, stsNameToRealName)
+	renameStss(opts.rotationPolicy(rc), new, stsNameToRealName)
+	if opts.blueGreen != nil {
+		var pinned []string
+		if pinned, err = pinServices(new, opts.blueGreen.serving); err != nil {
+			return
+		}
+		for _, key := range pinned {
+			changed[key] = true
+		}
+	}
+	var retargeted []string
+	if retargeted, err = retargetAll(new, stsNameToRealName); err != nil {
+		return
+	}
+	for _, key := range retargeted {
+		changed[key] = true
+	}
+	// the chart does not change the Services pinned to a rotation by a blue/green rollout or
+	// ForceRotate, they are moved to the rotations of a plain rollout before the old ones are removed
+	var repin []k8s.Resource
+	var rotations []string
+	if opts.blueGreen == nil && opts.result != nil {
+		for _, decision := range opts.result.Rotations {
+			if decision.Rotate {
+				rotations = append(rotations, decision.Next)
+			}
+		}
+		if len(rotations) > 0 {
+			repin = pinnedTo(rc, new, rotations...)
+		}
+	}
+	ordered := slices.Clone(new)
+	sortForApply(ordered)
+	var canaried []k8s.Resource
+	if opts.canary != nil {
+		for _, r := range ordered {
+			kind := r.GetObjectKind().GroupVersionKind().Kind
+			if kind == k8s.KindDeployment && changed[resourceKey(kind, r.GetName())] {
+				canaried = append(canaried, r)
+			}
+		}
+	}
 
-	for _, r := range new {
+	for _, r := range ordered {
 		kind := r.GetObjectKind().GroupVersionKind().Kind
 		key := resourceKey(kind, r.GetName())
-		if kind == k8s.KindHorizontalPodAutoscaler {
-			var hpa *k8s.HorizontalPodAutoscaler
-			hpa, _ = k8s.Parse[*k8s.HorizontalPodAutoscaler](r)
-			if hpa.Spec.ScaleTargetRef.Kind == k8s.KindStatefulSet {
-				targetStsName := hpa.Spec.ScaleTargetRef.Name
-				var exists bool
-				var realName string
-				if realName, exists = stsNameToRealName[targetStsName]; exists {
-					hpa.Spec.ScaleTargetRef.Name = realName
-					changed[key] = true
-				}
-
-			}
-		}
 		var didChange, exists bool
 		if didChange, exists = changed[key]; exists && !didChange {
 			rc.Logger().Infof(`applyManifest skipped for item: %s`, key)
 			continue
 		}
+		// the canaries run once what the Deployments depend on is applied, and gate them all
+		if len(canaried) > 0 && r == canaried[0] {
+			if err = opts.canary.run(rc, canaried, opts, owner); err != nil {
+				return
+			}
+		}
 		rc.Logger().Debugf(`applyManifest going for item: %s,conditons: %t,%t`, key, didChange, exists)
-		if err = k8s.Rollout(rc.Context(), r, k8s.WithWait(wait)); err != nil {
+		if owner != nil {
+			if err = owner.checkOwner(rc.Context(), r); err != nil {
+				return
+			}
+			if r, err = owner.stamp(r); err != nil {
+				return
+			}
+		}
+		if err = applyObject(rc, r, opts); err != nil {
 			return
 		}
 	}
 
+	if len(canaried) > 0 {
+		opts.canary.promote(rc, opts)
+	}
+	if err = repinServices(rc, repin, rotations, opts, owner); err != nil {
+		return
+	}
+	sortToRemoves(toRemoves)
 	for _, r := range toRemoves {
-		if err = k8s.Remove(rc.Context(), r.name, r.namespace, r.kind, k8s.WithWait(2*time.Minute)); err != nil {
-			rc.Logger().Warnf("failed to remove %s-%s/%s: %s", r.kind, r.namespace, r.name, err)
-		}
+		opts.remove(rc, r.kind, r.name, r.namespace, 2*time.Minute)
 	}
-	err = nil
 	return
 }
 
+// applyObject creates or updates r, with server-side apply if enabled or if k8s.Rollout does not
+// support its kind, see rolloutKinds.
+func applyObject(rc global.ResourceContext, r k8s.Resource, opts *operationOptions) error {
+	if opts.fieldManager != "" {
+		return applyServerSide(rc, r, opts)
+	}
+	if !slices.Contains(rolloutKinds, r.GetObjectKind().GroupVersionKind().Kind) {
+		ssa := *opts
+		ssa.fieldManager = DefaultFieldManager
+		return applyServerSide(rc, r, &ssa)
+	}
+	return doRollout(rc.Context(), r, k8s.WithWait(opts.wait))
+}
+
 var doRemove = func(ctx context.Context, name, namespace string, kind k8s.Kind, options ...k8s.OperationOption) error {
 	return k8s.Remove(ctx, name, namespace, kind, options...)
 }
@@ -410,34 +610,59 @@ var doRemove = func(ctx context.Context, name, namespace string, kind k8s.Kind,
 // It takes a resource context, the name and namespace of the resource to be removed,
 // and optional operation options.
 // It returns an error if there was a problem removing the resource.
+// Every rotation of the StatefulSets is removed, including the previous blue/green rotations.
+// When objects could not be removed, it returns a *RemovalError and keeps the manifest with the
+// failed removals so that Remove can be run again.
 func Remove(rc global.ResourceContext, name, namespace string, options ...OperationOption) error {
 	opts := &operationOptions{}
 	for _, opt := range options {
 		opt(opts)
 	}
+	if opts.result == nil {
+		opts.result = &Result{}
+	}
 	var err error
 	var old []k8s.Resource
 	if old, err = getExistingManifest(rc.Context(), name, namespace); err != nil {
 		return err
 	}
+	sortForRemove(old)
+	var blueGreens []*BlueGreenRotation
+	if cfg, err := getManifestConfigMap(rc.Context(), name, namespace); err == nil {
+		blueGreens = blueGreenFromData(cfg.Data)
+	}
 	for _, r := range old {
 
 		kind := r.GetObjectKind().GroupVersionKind().Kind
 		switch kind {
 		case k8s.KindStatefulSet:
-			var current = getCurrentRotation(rc.Context(), r.GetName(), rc.Namespace())
-			if current != nil {
-				if err = doRemove(rc.Context(), fmt.Sprintf("%s---%d", r.GetName(), current.rotation), r.GetNamespace(), k8s.KindStatefulSet, k8s.WithWait(opts.wait)); err != nil {
-					rc.Logger().Warnf("failed to remove %s-%s/%s: %s", k8s.KindStatefulSet, rc.Namespace(), r.GetName(), err)
-				}
+			var rotations []string
+			if current := getCurrentRotation(rc.Context(), r.GetName(), rc.Namespace()); current != nil {
+				rotations = slices.Clone(current.names)
 			} else {
 				rc.Logger().Warnf(`current rotation not found for %s/%s`, rc.Namespace(), r.GetName())
 			}
-		default:
-			if err = doRemove(rc.Context(), r.GetName(), r.GetNamespace(), r.GetObjectKind().GroupVersionKind().Kind, k8s.WithWait(opts.wait)); err != nil {
-				rc.Logger().Warnf("failed to remove %s-%s/%s: %s", r.GetObjectKind().GroupVersionKind().Kind, r.GetNamespace(), r.GetName(), err)
+			for _, bg := range blueGreens {
+				if bg.StatefulSet == r.GetName() && !slices.Contains(rotations, bg.Previous) {
+					rotations = append(rotations, bg.Previous)
+				}
+			}
+			for _, rotation := range rotations {
+				opts.remove(rc, k8s.KindStatefulSet, rotation, r.GetNamespace(), opts.wait)
 			}
+		default:
+			opts.remove(rc, kind, r.GetName(), r.GetNamespace(), opts.wait)
+		}
+	}
+	for _, pending := range getPendingRemovals(rc.Context(), name, namespace) {
+		opts.remove(rc, pending.Kind, pending.Name, pending.Namespace, opts.wait)
+	}
+	if failed := opts.result.FailedRemovals(); len(failed) > 0 {
+		rc.Logger().Warnf("keeping the manifest of %s/%s, %d removal(s) failed", namespace, name, len(failed))
+		if err = recordPendingRemovals(rc.Context(), name, namespace, opts.result); err != nil {
+			return err
 		}
+		return &RemovalError{Failed: failed}
 	}
 	if err = doRemove(rc.Context(), name+"-manifest", namespace, k8s.KindConfigMap, k8s.WithWait(opts.wait)); err != nil {
 		return err
@@ -2,6 +2,8 @@ package operation
 
 import (
 	"context"
+	"math"
+	"regexp"
 	"testing"
 
 	"github.com/nextbillion-ai/goreman-util/global"
@@ -30,7 +32,7 @@ spec:
 	if sts, err = k8s.Parse[*k8s.StatefulSet](r); err != nil {
 		panic(err)
 	}
-	should := shouldRename(sts)
+	should := shouldRename(global.DefaultRotationPolicy(), sts)
 	assert.True(t, should)
 }
 
@@ -55,7 +57,7 @@ spec:
 	if sts, err = k8s.Parse[*k8s.StatefulSet](r); err != nil {
 		panic(err)
 	}
-	should := shouldRename(sts)
+	should := shouldRename(global.DefaultRotationPolicy(), sts)
 	assert.False(t, should)
 }
 
@@ -78,7 +80,7 @@ spec:
 	if sts, err = k8s.Parse[*k8s.StatefulSet](r); err != nil {
 		panic(err)
 	}
-	should := shouldRename(sts)
+	should := shouldRename(global.DefaultRotationPolicy(), sts)
 	assert.False(t, should)
 }
 
@@ -107,7 +109,7 @@ spec:
 			"template": "whocares",
 		},
 	}
-	should := shouldRotate(global.NewContext(context.Background()), df, sts)
+	should := shouldRotate(global.NewContext(context.Background()), global.DefaultRotationPolicy(), df, sts)
 	assert.False(t, should)
 }
 
@@ -136,10 +138,52 @@ spec:
 			"template": "whocares",
 		},
 	}
-	should := shouldRotate(global.NewContext(context.Background()), df, sts)
+	should := shouldRotate(global.NewContext(context.Background()), global.DefaultRotationPolicy(), df, sts)
 	assert.True(t, should)
 }
 
+func TestShouldRotateWithPolicy(t *testing.T) {
+	var stsYaml = `
+kind: StatefulSet
+metadata:
+  name: sts1
+  annotations:
+    example.com/rotate: disabled
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - image: mysql:8`
+	var err error
+	var r k8s.Resource
+	if r, err = k8s.DecodeYAML(stsYaml); err != nil {
+		panic(err)
+	}
+	var sts *k8s.StatefulSet
+	if sts, err = k8s.Parse[*k8s.StatefulSet](r); err != nil {
+		panic(err)
+	}
+	rc := global.NewContext(context.Background())
+	df := raw.Map{
+		"spec": raw.Map{
+			"template": "whocares",
+		},
+	}
+	assert.True(t, shouldRotate(rc, global.DefaultRotationPolicy(), df, sts))
+	assert.False(t, shouldRename((&global.RotationPolicy{AnnotationKey: "example.com/rotate"}).WithDefaults(), sts))
+	assert.False(t, shouldRename((&global.RotationPolicy{ImageBlacklist: []string{`^mysql`}}).WithDefaults(), sts))
+	inPlace := (&global.RotationPolicy{SingleReplicaInPlace: true}).WithDefaults()
+	assert.False(t, shouldRotate(rc, inPlace, df, sts))
+	df = raw.Map{
+		"spec": raw.Map{
+			"podManagementPolicy": "Parallel",
+		},
+	}
+	assert.True(t, shouldRotate(rc, inPlace, df, sts))
+	assert.False(t, shouldRotate(rc, (&global.RotationPolicy{SingleReplicaInPlace: true, InPlaceFields: []string{"podManagementPolicy"}}).WithDefaults(), df, sts))
+}
+
 func TestRotateStsHP(t *testing.T) {
 	org := getCurrentRotation
 	defer func() {
@@ -188,11 +232,12 @@ spec:
 	rc := global.NewContext(context.Background(), global.WithLogLevel(logrus.ErrorLevel))
 
 	toRemoves := []toRemove{}
-	var rotated bool
-	if rotated, err = rotateSts(rc, old, &new, &toRemoves, df); err != nil {
+	var decision *RotationDecision
+	if decision, err = rotateSts(rc, global.RotationPolicyOf(rc), old, &new, &toRemoves, df); err != nil {
 		panic(err)
 	}
-	assert.True(t, rotated)
+	assert.True(t, decision.Rotate)
+	assert.Equal(t, "sts1---3", decision.Next)
 	assert.Equal(t, "sts1---3", new.GetName())
 }
 
@@ -242,11 +287,11 @@ spec:
 	}
 	rc := global.NewContext(context.Background(), global.WithLogLevel(logrus.ErrorLevel))
 	toRemoves := []toRemove{}
-	var rotated bool
-	if rotated, err = rotateSts(rc, old, &new, &toRemoves, df); err != nil {
+	var decision *RotationDecision
+	if decision, err = rotateSts(rc, global.RotationPolicyOf(rc), old, &new, &toRemoves, df); err != nil {
 		panic(err)
 	}
-	assert.False(t, rotated)
+	assert.False(t, decision.Rotate)
 	assert.Equal(t, "sts1---2", new.GetName())
 }
 
@@ -273,10 +318,12 @@ spec:
 	}
 	list := []k8s.Resource{r}
 	nameMap := map[string]string{}
-	renameStss(list, nameMap)
+	renameStss(global.DefaultRotationPolicy(), list, nameMap)
 	r = list[0]
 	assert.Equal(t, "sts1---0", r.GetName())
 	assert.Equal(t, "sts1---0", nameMap["sts1"])
+	sts, _ := k8s.Parse[*k8s.StatefulSet](r)
+	assert.Equal(t, "sts1---0", sts.Spec.Template.Labels[realNameLabel])
 }
 
 func TestRemove(t *testing.T) {
@@ -297,18 +344,27 @@ spec:
 	}
 	orgGetCurrentRotation := getCurrentRotation
 	orgGetExistingManifest := getExistingManifest
+	orgGetManifestConfigMap := getManifestConfigMap
 	orgDoRemove := doRemove
 	defer func() {
 		getCurrentRotation = orgGetCurrentRotation
 		getExistingManifest = orgGetExistingManifest
+		getManifestConfigMap = orgGetManifestConfigMap
 		doRemove = orgDoRemove
 	}()
 	getCurrentRotation = func(ctx context.Context, name, namespace string) *currentRotations {
 		return &currentRotations{
-			rotation: 0,
-			names:    []string{"sts1---0"},
+			rotation: 2,
+			names:    []string{"sts1---1", "sts1---2"},
 		}
 	}
+	getManifestConfigMap = func(ctx context.Context, name, namespace string) (*k8s.ConfigMap, error) {
+		data, err := blueGreenData([]*BlueGreenRotation{
+			{StatefulSet: "sts1", Previous: "sts1---0", Current: "sts1---2"},
+			{StatefulSet: "other", Previous: "other---0", Current: "other---1"},
+		})
+		return &k8s.ConfigMap{Data: data}, err
+	}
 
 	getExistingManifest = func(ctx context.Context, name, namespace string) (existing []k8s.Resource, err error) {
 		return []k8s.Resource{r}, nil
@@ -324,6 +380,111 @@ spec:
 	if err = Remove(rc, "sts1", "whocares"); err != nil {
 		t.Fatal(err)
 	}
-	assert.True(t, removed["sts1---0"])
-	assert.True(t, removed["sts1-manifest"])
+	assert.Equal(t, map[string]bool{"sts1---0": true, "sts1---1": true, "sts1---2": true, "sts1-manifest": true}, removed)
+}
+
+func TestIndexResources(t *testing.T) {
+	list, err := k8s.DecodeAllYAML(`
+kind: StatefulSet
+metadata:
+  name: sts1
+---
+kind: Service
+metadata:
+  name: svc1`)
+	assert.NoError(t, err)
+	index := indexResources(list)
+	sts := &k8s.StatefulSet{}
+	sts.Kind, sts.Name = k8s.KindStatefulSet, "sts1---2"
+	*index[resourceKey(k8s.KindStatefulSet, "sts1")] = sts
+	assert.Equal(t, "sts1---2", list[0].GetName())
+	assert.Equal(t, "svc1", list[1].GetName())
+}
+
+func TestRotateStsThroughIndex(t *testing.T) {
+	org := getCurrentRotation
+	defer func() {
+		getCurrentRotation = org
+	}()
+	getCurrentRotation = func(ctx context.Context, name, namespace string) *currentRotations {
+		return &currentRotations{rotation: 1, names: []string{"sts1---1"}}
+	}
+	old, err := k8s.DecodeYAML(`
+kind: StatefulSet
+metadata:
+  name: sts1
+spec:
+  replicas: 2
+  serviceName: old`)
+	assert.NoError(t, err)
+	list, err := k8s.DecodeAllYAML(`
+kind: StatefulSet
+metadata:
+  name: sts1
+spec:
+  replicas: 2
+  serviceName: new`)
+	assert.NoError(t, err)
+	df, err := raw.Diff(old, list[0])
+	assert.NoError(t, err)
+	rc := global.NewContext(context.Background(), global.WithLogLevel(logrus.ErrorLevel))
+	toRemoves := []toRemove{}
+	decision, err := rotateSts(rc, global.RotationPolicyOf(rc), old, indexResources(list)[resourceKey(k8s.KindStatefulSet, "sts1")], &toRemoves, df)
+	assert.NoError(t, err)
+	assert.True(t, decision.Rotate)
+	assert.Equal(t, "sts1---2", list[0].GetName())
+}
+
+func TestGetCurrentRotation(t *testing.T) {
+	org := listStatefulSets
+	defer func() {
+		listStatefulSets = org
+	}()
+	sts := func(name, realName string) *k8s.StatefulSet {
+		s := &k8s.StatefulSet{}
+		s.Name = name
+		if realName != "" {
+			setLabel(&s.ObjectMeta, realNameLabel, realName)
+		}
+		return s
+	}
+	all := []*k8s.StatefulSet{
+		sts("app---9", "app---9"),
+		sts("app---10", "app---10"),
+		sts("app---2", ""),
+		sts("my-app---11", "my-app---11"),
+		sts("app-api---12", "app-api---12"),
+		sts("app---13", "other---13"),
+		sts("app---99999999999999999999", ""),
+		sts("app---1x", ""),
+	}
+	listStatefulSets = func(ctx context.Context, namespace string, pattern *regexp.Regexp) ([]*k8s.StatefulSet, error) {
+		var matched []*k8s.StatefulSet
+		for _, s := range all {
+			if pattern.MatchString(s.GetName()) {
+				matched = append(matched, s)
+			}
+		}
+		return matched, nil
+	}
+	current := getCurrentRotation(context.Background(), "app", "ns")
+	assert.Equal(t, 10, current.rotation)
+	assert.Equal(t, []string{"app---2", "app---9", "app---10"}, current.names)
+
+	current = getCurrentRotation(context.Background(), "app-api", "ns")
+	assert.Equal(t, 12, current.rotation)
+	assert.Equal(t, []string{"app-api---12"}, current.names)
+
+	assert.Nil(t, getCurrentRotation(context.Background(), "api", "ns"))
+
+	_, err := (&currentRotations{rotation: math.MaxInt}).next()
+	assert.Error(t, err)
+}
+
+func TestExtractRotation(t *testing.T) {
+	rotation, err := extractRotation("app---0---12")
+	assert.NoError(t, err)
+	assert.Equal(t, 12, rotation)
+	_, err = extractRotation("app---12x")
+	assert.Error(t, err)
 }
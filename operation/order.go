@@ -0,0 +1,92 @@
+package operation
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+
+	"github.com/zhchang/goquiver/k8s"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+)
+
+// AnnotationApplyWeight overrides the apply order of an object. Objects are applied by ascending
+// weight (0 when unset) and, for equal weights, by the phase of their kind. Remove uses the
+// reverse order, and so do the removals of a rollout.
+const AnnotationApplyWeight = "foreman/apply-weight"
+
+// kindPhases orders kinds so that objects are applied after what they depend on.
+var kindPhases = map[k8s.Kind]int{
+	k8s.KindCustomResourceDefinition: 1,
+	k8s.KindStorageClass:             2,
+	k8s.KindPersistentVolume:         2,
+	k8s.KindServiceAccount:           3,
+	k8s.KindClusterRole:              3,
+	k8s.KindClusterRoleBinding:       3,
+	k8s.KindRole:                     3,
+	k8s.KindRoleBinding:              3,
+	k8s.KindConfigMap:                4,
+	k8s.KindSecret:                   4,
+	k8s.KindPersistentVolumeClaim:    4,
+	k8s.KindService:                  5,
+	k8s.KindDeployment:               6,
+	k8s.KindStatefulSet:              6,
+	k8s.KindDaemonSet:                6,
+	k8s.KindJob:                      6,
+	k8s.KindCronJob:                  6,
+	k8s.KindPod:                      6,
+	k8s.KindHorizontalPodAutoscaler:  7,
+	k8s.KindPodDisruptionBudget:      7,
+	k8s.KindIngress:                  7,
+}
+
+// customResourcePhase is the phase of kinds not in kindPhases, i.e. custom resources, which are
+// applied with the workloads once their definitions exist.
+const customResourcePhase = 6
+
+func kindPhase(kind k8s.Kind) int {
+	if phase, ok := kindPhases[kind]; ok {
+		return phase
+	}
+	return customResourcePhase
+}
+
+// applyWeight returns the weight annotated on r, invalid weights count as 0.
+func applyWeight(r k8s.Resource) int {
+	meta, err := apimeta.Accessor(r)
+	if err != nil {
+		return 0
+	}
+	weight, err := strconv.Atoi(meta.GetAnnotations()[AnnotationApplyWeight])
+	if err != nil {
+		return 0
+	}
+	return weight
+}
+
+func compareOrder(weightA int, kindA k8s.Kind, weightB int, kindB k8s.Kind) int {
+	return cmp.Or(cmp.Compare(weightA, weightB), cmp.Compare(kindPhase(kindA), kindPhase(kindB)))
+}
+
+func compareApplyOrder(a, b k8s.Resource) int {
+	return compareOrder(applyWeight(a), a.GetObjectKind().GroupVersionKind().Kind, applyWeight(b), b.GetObjectKind().GroupVersionKind().Kind)
+}
+
+// sortForApply sorts list in apply order, keeping the chart order of equivalent objects.
+func sortForApply(list []k8s.Resource) {
+	slices.SortStableFunc(list, compareApplyOrder)
+}
+
+// sortForRemove sorts list in the reverse of the apply order.
+func sortForRemove(list []k8s.Resource) {
+	slices.SortStableFunc(list, func(a, b k8s.Resource) int {
+		return compareApplyOrder(b, a)
+	})
+}
+
+// sortToRemoves sorts objects removed by a rollout in the reverse of the apply order, like
+// sortForRemove.
+func sortToRemoves(toRemoves []toRemove) {
+	slices.SortStableFunc(toRemoves, func(a, b toRemove) int {
+		return compareOrder(b.weight, b.kind, a.weight, a.kind)
+	})
+}
@@ -0,0 +1,75 @@
+package operation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhchang/goquiver/k8s"
+)
+
+func TestSortForApply(t *testing.T) {
+	list, err := k8s.DecodeAllYAML(`
+kind: HorizontalPodAutoscaler
+apiVersion: autoscaling/v2
+metadata:
+  name: hpa
+---
+kind: Deployment
+apiVersion: apps/v1
+metadata:
+  name: deploy
+---
+kind: Widget
+apiVersion: example.com/v1
+metadata:
+  name: widget
+---
+kind: ConfigMap
+apiVersion: v1
+metadata:
+  name: cfg2
+---
+kind: CustomResourceDefinition
+apiVersion: apiextensions.k8s.io/v1
+metadata:
+  name: widgets.example.com
+---
+kind: ConfigMap
+apiVersion: v1
+metadata:
+  name: cfg1
+---
+kind: Job
+apiVersion: batch/v1
+metadata:
+  name: migrate
+  annotations:
+    foreman/apply-weight: "-1"
+---
+kind: ServiceAccount
+apiVersion: v1
+metadata:
+  name: sa`)
+	assert.NoError(t, err)
+	names := func() []string {
+		var names []string
+		for _, r := range list {
+			names = append(names, r.GetName())
+		}
+		return names
+	}
+
+	sortForApply(list)
+	assert.Equal(t, []string{"migrate", "widgets.example.com", "sa", "cfg2", "cfg1", "deploy", "widget", "hpa"}, names())
+
+	sortForRemove(list)
+	assert.Equal(t, []string{"hpa", "deploy", "widget", "cfg2", "cfg1", "sa", "widgets.example.com", "migrate"}, names())
+
+	toRemoves := []toRemove{{name: "job", kind: k8s.KindJob, weight: -1}, {name: "cfg", kind: k8s.KindConfigMap}, {name: "sts", kind: k8s.KindStatefulSet}, {name: "pdb", kind: k8s.KindPodDisruptionBudget}, {name: "late", kind: k8s.KindConfigMap, weight: 1}}
+	sortToRemoves(toRemoves)
+	var removeNames []string
+	for _, r := range toRemoves {
+		removeNames = append(removeNames, r.name)
+	}
+	assert.Equal(t, []string{"late", "pdb", "sts", "cfg", "job"}, removeNames)
+}
@@ -0,0 +1,78 @@
+package operation
+
+import (
+	"slices"
+	"strconv"
+
+	"github.com/zhchang/goquiver/k8s"
+)
+
+// AnnotationKeepOnRemove keeps an object in the cluster when it is removed from the chart. The
+// object is reported as an orphan instead.
+const AnnotationKeepOnRemove = "foreman/keep-on-remove"
+
+// defaultNeverPruneKinds are the kinds Rollout never deletes when they are removed from the chart,
+// unless WithNeverPruneKinds says otherwise.
+var defaultNeverPruneKinds = []k8s.Kind{
+	k8s.KindCustomResourceDefinition,
+	k8s.KindPersistentVolume,
+	k8s.KindPersistentVolumeClaim,
+}
+
+// Reasons an object removed from the chart was left in the cluster.
+const (
+	OrphanKeepOnRemove = "keep-on-remove"
+	OrphanNeverPrune   = "never-prune"
+	OrphanNotConfirmed = "not-confirmed"
+)
+
+// Orphan is an object that was removed from the chart but left in the cluster. It is no longer
+// part of the manifest and has to be cleaned up by hand.
+type Orphan struct {
+	Kind      k8s.Kind
+	Name      string
+	Namespace string
+	Reason    string
+}
+
+// DefaultNeverPruneKinds returns a copy of the kinds Rollout never deletes when they are removed
+// from the chart, unless WithNeverPruneKinds says otherwise.
+func DefaultNeverPruneKinds() []k8s.Kind {
+	return slices.Clone(defaultNeverPruneKinds)
+}
+
+// WithNeverPruneKinds replaces DefaultNeverPruneKinds for a rollout.
+func WithNeverPruneKinds(kinds ...k8s.Kind) OperationOption {
+	return func(opts *operationOptions) {
+		opts.neverPrune = slices.Clone(kinds)
+		opts.neverPruneSet = true
+	}
+}
+
+// WithPruneConfirmation makes Rollout ask confirm before deleting every object removed from the
+// chart. Objects that are not confirmed are left in the cluster and reported as orphans.
+func WithPruneConfirmation(confirm func(Orphan) bool) OperationOption {
+	return func(opts *operationOptions) {
+		opts.confirmPrune = confirm
+	}
+}
+
+// orphanReason returns why r, which was removed from the chart, must be left in the cluster, or
+// an empty string if it can be deleted.
+func (opts *operationOptions) orphanReason(r k8s.Resource) string {
+	if keep, _ := strconv.ParseBool(annotation(r, AnnotationKeepOnRemove)); keep {
+		return OrphanKeepOnRemove
+	}
+	neverPrune := defaultNeverPruneKinds
+	if opts.neverPruneSet {
+		neverPrune = opts.neverPrune
+	}
+	kind := r.GetObjectKind().GroupVersionKind().Kind
+	if slices.Contains(neverPrune, kind) {
+		return OrphanNeverPrune
+	}
+	if opts.confirmPrune != nil && !opts.confirmPrune(Orphan{Kind: kind, Name: r.GetName(), Namespace: r.GetNamespace()}) {
+		return OrphanNotConfirmed
+	}
+	return ""
+}
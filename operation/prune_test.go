@@ -0,0 +1,55 @@
+package operation
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhchang/goquiver/k8s"
+)
+
+func TestOrphanReason(t *testing.T) {
+	list, err := k8s.DecodeAllYAML(`
+kind: ConfigMap
+apiVersion: v1
+metadata:
+  name: kept
+  annotations:
+    foreman/keep-on-remove: "true"
+---
+kind: PersistentVolumeClaim
+apiVersion: v1
+metadata:
+  name: data
+---
+kind: Service
+apiVersion: v1
+metadata:
+  name: svc`)
+	assert.NoError(t, err)
+	reasons := func(options ...OperationOption) []string {
+		opts := &operationOptions{}
+		for _, opt := range options {
+			opt(opts)
+		}
+		var reasons []string
+		for _, r := range list {
+			reasons = append(reasons, opts.orphanReason(r))
+		}
+		return reasons
+	}
+
+	assert.Equal(t, []string{OrphanKeepOnRemove, OrphanNeverPrune, ""}, reasons())
+	defaults := DefaultNeverPruneKinds()
+	defaults[slices.Index(defaults, k8s.KindPersistentVolumeClaim)] = k8s.KindService
+	assert.Equal(t, []string{OrphanKeepOnRemove, OrphanNeverPrune, ""}, reasons())
+	assert.Equal(t, []string{OrphanKeepOnRemove, "", OrphanNeverPrune}, reasons(WithNeverPruneKinds(k8s.KindService)))
+
+	var asked []string
+	confirm := WithPruneConfirmation(func(o Orphan) bool {
+		asked = append(asked, o.Kind+"/"+o.Name)
+		return o.Kind == k8s.KindPersistentVolumeClaim
+	})
+	assert.Equal(t, []string{OrphanKeepOnRemove, "", OrphanNotConfirmed}, reasons(WithNeverPruneKinds(), confirm))
+	assert.Equal(t, []string{"PersistentVolumeClaim/data", "Service/svc"}, asked)
+}
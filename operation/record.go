@@ -0,0 +1,76 @@
+package operation
+
+import (
+	"context"
+	"time"
+
+	"github.com/zhchang/goquiver/k8s"
+)
+
+const (
+	manifestKey     = "manifest"
+	assetTypeKey    = "assetType"
+	assetReleaseKey = "assetRelease"
+	valuesHashKey   = "valuesHash"
+	deployTimeKey   = "deployTime"
+	rolloutIDKey    = "rolloutId"
+)
+
+// Record describes a rollout. It is stored next to the manifest of the rollout.
+//
+// Fields:
+// AssetType, AssetRelease: The asset the resource was rendered from.
+// ValuesHash: A hash of the app values the asset was rendered with.
+// DeployTime: When the rollout happened.
+// RolloutID: Identifies the rollout, generated by Rollout when empty.
+type Record struct {
+	AssetType    string
+	AssetRelease string
+	ValuesHash   string
+	DeployTime   time.Time
+	RolloutID    string
+}
+
+// WithRecord sets the record stored with the manifest written by Rollout.
+func WithRecord(record *Record) OperationOption {
+	return func(opts *operationOptions) {
+		opts.record = record
+	}
+}
+
+func (r *Record) data() map[string]string {
+	data := map[string]string{}
+	if r == nil {
+		data[deployTimeKey] = time.Now().UTC().Format(time.RFC3339)
+		return data
+	}
+	data[assetTypeKey] = r.AssetType
+	data[assetReleaseKey] = r.AssetRelease
+	data[valuesHashKey] = r.ValuesHash
+	if r.RolloutID != "" {
+		data[rolloutIDKey] = r.RolloutID
+	}
+	deployTime := r.DeployTime
+	if deployTime.IsZero() {
+		deployTime = time.Now()
+	}
+	data[deployTimeKey] = deployTime.UTC().Format(time.RFC3339)
+	return data
+}
+
+func recordFromData(data map[string]string) *Record {
+	r := &Record{
+		AssetType:    data[assetTypeKey],
+		AssetRelease: data[assetReleaseKey],
+		ValuesHash:   data[valuesHashKey],
+		RolloutID:    data[rolloutIDKey],
+	}
+	if value, ok := data[deployTimeKey]; ok {
+		r.DeployTime, _ = time.Parse(time.RFC3339, value)
+	}
+	return r
+}
+
+var getManifestConfigMap = func(ctx context.Context, name, namespace string) (*k8s.ConfigMap, error) {
+	return k8s.Get[*k8s.ConfigMap](ctx, name+"-manifest", namespace)
+}
@@ -0,0 +1,138 @@
+package operation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nextbillion-ai/goreman-util/global"
+	"github.com/zhchang/goquiver/k8s"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// pendingRemovalsKey holds the removals that failed during the last rollout, they are retried by
+// the next one.
+const pendingRemovalsKey = "pendingRemovals"
+
+// Removal is an attempt to delete an object. Err is nil when the object was deleted or was
+// already gone.
+type Removal struct {
+	Kind      k8s.Kind `json:"kind"`
+	Name      string   `json:"name"`
+	Namespace string   `json:"namespace"`
+	Err       error    `json:"-"`
+}
+
+// RemovalError is returned by Remove, and by Rollout in strict removal mode, when objects could not
+// be deleted.
+type RemovalError struct {
+	Failed []Removal
+}
+
+func (e *RemovalError) Error() string {
+	var failed []string
+	for _, r := range e.Failed {
+		failed = append(failed, fmt.Sprintf("%s %s/%s: %s", r.Kind, r.Namespace, r.Name, r.Err))
+	}
+	return fmt.Sprintf("failed to remove %d object(s): %s", len(e.Failed), strings.Join(failed, "; "))
+}
+
+// WithStrictRemoval makes Rollout return a *RemovalError when objects could not be deleted, instead
+// of only logging it. Either way the failed removals are recorded with the manifest and retried by
+// the next rollout. Remove always returns a *RemovalError when removals fail.
+func WithStrictRemoval() OperationOption {
+	return func(opts *operationOptions) {
+		opts.strictRemoval = true
+	}
+}
+
+// FailedRemovals returns the removals of the result that failed.
+func (r *Result) FailedRemovals() []Removal {
+	var failed []Removal
+	for _, removal := range r.Removals {
+		if removal.Err != nil {
+			failed = append(failed, removal)
+		}
+	}
+	return failed
+}
+
+// removalError returns a *RemovalError if strict removal is enabled and removals failed.
+func (opts *operationOptions) removalError() error {
+	if failed := opts.result.FailedRemovals(); opts.strictRemoval && len(failed) > 0 {
+		return &RemovalError{Failed: failed}
+	}
+	return nil
+}
+
+// remove deletes an object, records the attempt in the result and logs failures. The claims of
+// StatefulSets are handled according to their volume policy, see AnnotationVolumePolicy.
+func (opts *operationOptions) remove(rc global.ResourceContext, kind k8s.Kind, name, namespace string, wait time.Duration) {
+	if kind == k8s.KindStatefulSet {
+		opts.removeStatefulSet(rc, name, namespace, wait)
+		return
+	}
+	opts.removeObject(rc, kind, name, namespace, wait)
+}
+
+// removeObject deletes an object, records the attempt in the result and logs failures.
+func (opts *operationOptions) removeObject(rc global.ResourceContext, kind k8s.Kind, name, namespace string, wait time.Duration) {
+	removal := Removal{Kind: kind, Name: name, Namespace: namespace}
+	if removal.Err = doRemove(rc.Context(), name, namespace, kind, k8s.WithWait(wait)); apierrors.IsNotFound(removal.Err) {
+		removal.Err = nil
+	}
+	if removal.Err != nil {
+		rc.Logger().Warnf("failed to remove %s-%s/%s: %s", kind, namespace, name, removal.Err)
+	}
+	opts.result.Removals = append(opts.result.Removals, removal)
+}
+
+// getPendingRemovals returns the removals the last rollout of the named resource failed to do.
+func getPendingRemovals(ctx context.Context, name, namespace string) []Removal {
+	cfg, err := getManifestConfigMap(ctx, name, namespace)
+	if err != nil || cfg.Data[pendingRemovalsKey] == "" {
+		return nil
+	}
+	var pending []Removal
+	if err = json.Unmarshal([]byte(cfg.Data[pendingRemovalsKey]), &pending); err != nil {
+		return nil
+	}
+	return pending
+}
+
+// recordPendingRemovals replaces the pending removals recorded in the manifest ConfigMap of the
+// named resource with the failed removals of result.
+func recordPendingRemovals(ctx context.Context, name, namespace string, result *Result) error {
+	cfg, err := getManifestConfigMap(ctx, name, namespace)
+	if err != nil {
+		return err
+	}
+	var data map[string]string
+	if data, err = pendingRemovalsData(result); err != nil {
+		return err
+	}
+	if cfg.Data == nil {
+		cfg.Data = map[string]string{}
+	}
+	delete(cfg.Data, pendingRemovalsKey)
+	for key, value := range data {
+		cfg.Data[key] = value
+	}
+	cfg.Kind = k8s.KindConfigMap
+	return doRollout(ctx, cfg)
+}
+
+// pendingRemovalsData encodes the failed removals of result to be stored with the manifest.
+func pendingRemovalsData(result *Result) (map[string]string, error) {
+	failed := result.FailedRemovals()
+	if len(failed) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(failed)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{pendingRemovalsKey: string(data)}, nil
+}
@@ -0,0 +1,160 @@
+package operation
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nextbillion-ai/goreman-util/global"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhchang/goquiver/k8s"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestRemoveStrict(t *testing.T) {
+	orgGetExistingManifest := getExistingManifest
+	orgGetManifestConfigMap := getManifestConfigMap
+	orgDoRemove := doRemove
+	orgDoRollout := doRollout
+	defer func() {
+		getExistingManifest = orgGetExistingManifest
+		getManifestConfigMap = orgGetManifestConfigMap
+		doRemove = orgDoRemove
+		doRollout = orgDoRollout
+	}()
+	getExistingManifest = func(ctx context.Context, name, namespace string) ([]k8s.Resource, error) {
+		return k8s.DecodeAllYAML(`
+kind: Service
+apiVersion: v1
+metadata:
+  name: svc
+  namespace: ns
+---
+kind: ConfigMap
+apiVersion: v1
+metadata:
+  name: cfg
+  namespace: ns`)
+	}
+	pending, err := pendingRemovalsData(&Result{Removals: []Removal{
+		{Kind: k8s.KindStatefulSet, Name: "sts---1", Namespace: "ns", Err: errors.New("timeout")},
+		{Kind: k8s.KindService, Name: "gone", Namespace: "ns"},
+	}})
+	assert.NoError(t, err)
+	getManifestConfigMap = func(ctx context.Context, name, namespace string) (*k8s.ConfigMap, error) {
+		return &k8s.ConfigMap{Data: maps.Clone(pending)}, nil
+	}
+	var recorded *k8s.ConfigMap
+	doRollout = func(ctx context.Context, item k8s.Resource, options ...k8s.OperationOption) error {
+		recorded = item.(*k8s.ConfigMap)
+		return nil
+	}
+	var removed []string
+	forbidden := true
+	doRemove = func(ctx context.Context, name, namespace string, kind k8s.Kind, options ...k8s.OperationOption) error {
+		removed = append(removed, name)
+		switch name {
+		case "svc":
+			if forbidden {
+				return errors.New("forbidden")
+			}
+		case "cfg":
+			return apierrors.NewNotFound(schema.GroupResource{Resource: kind}, name)
+		}
+		return nil
+	}
+	rc := global.NewContext(context.Background(), global.WithNamespace("ns"), global.WithLogLevel(logrus.ErrorLevel))
+
+	result := &Result{}
+	var removalErr *RemovalError
+	assert.True(t, errors.As(Remove(rc, "app", "ns", WithResult(result)), &removalErr))
+	assert.Equal(t, []string{"svc", "cfg", "sts---1"}, removed)
+	assert.Len(t, result.Removals, 3)
+	assert.Equal(t, []Removal{{Kind: k8s.KindService, Name: "svc", Namespace: "ns", Err: errors.New("forbidden")}}, result.FailedRemovals())
+	assert.JSONEq(t, `[{"kind":"Service","name":"svc","namespace":"ns"}]`, recorded.Data[pendingRemovalsKey])
+
+	removed = nil
+	result = &Result{}
+	err = Remove(rc, "app", "ns", WithStrictRemoval(), WithResult(result))
+	assert.True(t, errors.As(err, &removalErr))
+	assert.Len(t, removalErr.Failed, 1)
+	assert.ErrorContains(t, err, "Service ns/svc: forbidden")
+	assert.NotContains(t, removed, "app-manifest")
+
+	forbidden = false
+	removed = nil
+	recorded = nil
+	assert.NoError(t, Remove(rc, "app", "ns", WithStrictRemoval()))
+	assert.Equal(t, []string{"svc", "cfg", "sts---1", "app-manifest"}, removed)
+	assert.Nil(t, recorded)
+
+	assert.Equal(t, []Removal{{Kind: k8s.KindStatefulSet, Name: "sts---1", Namespace: "ns"}}, getPendingRemovals(context.Background(), "app", "ns"))
+}
+
+func TestRolloutRetriesPendingRemovals(t *testing.T) {
+	orgGetManifestConfigMap := getManifestConfigMap
+	orgGetLive := getLive
+	orgDoRollout := doRollout
+	orgDoRemove := doRemove
+	defer func() {
+		getManifestConfigMap = orgGetManifestConfigMap
+		getLive = orgGetLive
+		doRollout = orgDoRollout
+		doRemove = orgDoRemove
+	}()
+	chart := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(chart, "Chart.yaml"), []byte("apiVersion: v2\nname: app\nversion: 0.1.0\n"), 0o644))
+	assert.NoError(t, os.Mkdir(filepath.Join(chart, "templates"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(chart, "templates", "cm.yaml"), []byte(`
+kind: ConfigMap
+apiVersion: v1
+metadata:
+  name: {{ .Values.global.name }}
+data:
+  key: value`), 0o644))
+	values := map[string]any{"global": map[string]any{"name": "app", "namespace": "ns"}}
+
+	pending, err := pendingRemovalsData(&Result{Removals: []Removal{
+		{Kind: k8s.KindService, Name: "gone", Namespace: "ns", Err: errors.New("timeout")},
+		{Kind: k8s.KindConfigMap, Name: "app", Namespace: "ns", Err: errors.New("timeout")},
+	}})
+	assert.NoError(t, err)
+	getManifestConfigMap = func(ctx context.Context, name, namespace string) (*k8s.ConfigMap, error) {
+		return &k8s.ConfigMap{Data: maps.Clone(pending)}, nil
+	}
+	getLive = func(ctx context.Context, kind k8s.Kind, name, namespace string) (k8s.Resource, error) {
+		return nil, errors.New("not found")
+	}
+	var recorded *k8s.ConfigMap
+	doRollout = func(ctx context.Context, item k8s.Resource, options ...k8s.OperationOption) error {
+		if item.GetName() == "app-manifest" {
+			recorded = item.(*k8s.ConfigMap)
+		}
+		return nil
+	}
+	var removed []string
+	failing := true
+	doRemove = func(ctx context.Context, name, namespace string, kind k8s.Kind, options ...k8s.OperationOption) error {
+		removed = append(removed, name)
+		if failing {
+			return errors.New("timeout")
+		}
+		return nil
+	}
+	rc := global.NewContext(context.Background(), global.WithNamespace("ns"), global.WithLogLevel(logrus.ErrorLevel))
+
+	assert.NoError(t, Rollout(rc, chart, values))
+	assert.Equal(t, []string{"gone"}, removed)
+	assert.JSONEq(t, `[{"kind":"Service","name":"gone","namespace":"ns"}]`, recorded.Data[pendingRemovalsKey])
+
+	failing = false
+	removed = nil
+	assert.NoError(t, Rollout(rc, chart, values))
+	assert.Equal(t, []string{"gone"}, removed)
+	assert.NotContains(t, recorded.Data, pendingRemovalsKey)
+}
@@ -0,0 +1,29 @@
+package operation
+
+// Result describes what a Rollout did, see WithResult.
+//
+// Fields:
+// RolloutID: The id of the rollout, as recorded with the manifest.
+// Orphans: The objects removed from the chart that were left in the cluster.
+// Removals: Every object deletion attempted, see FailedRemovals.
+// Rotations: Whether and why every StatefulSet of the previous manifest was rotated.
+// BlueGreen: The StatefulSets rotated in blue/green mode, see WithBlueGreen.
+// Canaries: The canaries of the Deployments updated, see WithCanary.
+// Volumes: The claims of StatefulSet rotations deleted, retained or cloned, see AnnotationVolumePolicy.
+type Result struct {
+	RolloutID string
+	Orphans   []Orphan
+	Removals  []Removal
+	Rotations []*RotationDecision
+	BlueGreen []*BlueGreenRotation
+	Volumes   []VolumeChange
+	Canaries  []*Canary
+}
+
+// WithResult makes Rollout and Remove fill result. The result is filled as far as the operation
+// went, also when it fails.
+func WithResult(result *Result) OperationOption {
+	return func(opts *operationOptions) {
+		opts.result = result
+	}
+}
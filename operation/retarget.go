@@ -0,0 +1,193 @@
+package operation
+
+import (
+	"sync"
+
+	"github.com/zhchang/goquiver/k8s"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Retargeter points the references to StatefulSets of obj at their current rotation. realNames maps
+// the name of a StatefulSet in the manifest to the name of its rotation. It reports whether obj was
+// changed.
+type Retargeter func(obj *unstructured.Unstructured, realNames map[string]string) (bool, error)
+
+var (
+	retargetersLock sync.RWMutex
+	retargeters     = map[string]Retargeter{
+		k8s.KindHorizontalPodAutoscaler: RetargetRef("spec", "scaleTargetRef"),
+		"VerticalPodAutoscaler":         RetargetRef("spec", "targetRef"),
+		k8s.KindService:                 RetargetLabels("spec", "selector"),
+		k8s.KindPodDisruptionBudget:     RetargetSelector("spec", "selector"),
+		"ServiceMonitor":                RetargetSelector("spec", "selector"),
+		"PodMonitor":                    RetargetSelector("spec", "selector"),
+		"NetworkPolicy":                 retargetNetworkPolicy,
+	}
+)
+
+// RegisterRetargeter sets the Retargeter of kind, replacing the built-in one if any. A nil
+// retargeter leaves the objects of kind untouched.
+func RegisterRetargeter(kind string, retargeter Retargeter) {
+	retargetersLock.Lock()
+	defer retargetersLock.Unlock()
+	if retargeter == nil {
+		delete(retargeters, kind)
+		return
+	}
+	retargeters[kind] = retargeter
+}
+
+func retargeterOf(kind string) Retargeter {
+	retargetersLock.RLock()
+	defer retargetersLock.RUnlock()
+	return retargeters[kind]
+}
+
+// RetargetRef returns a Retargeter renaming the object reference found at path (a
+// CrossVersionObjectReference like the scaleTargetRef of a HorizontalPodAutoscaler) when it refers
+// to a rotated StatefulSet.
+func RetargetRef(path ...string) Retargeter {
+	return func(obj *unstructured.Unstructured, realNames map[string]string) (bool, error) {
+		ref, found, err := unstructured.NestedMap(obj.Object, path...)
+		if err != nil || !found || ref["kind"] != k8s.KindStatefulSet {
+			return false, err
+		}
+		name, _ := ref["name"].(string)
+		realName, ok := realNames[name]
+		if !ok || realName == name {
+			return false, nil
+		}
+		return true, unstructured.SetNestedField(obj.Object, realName, append(path, "name")...)
+	}
+}
+
+// RetargetLabels returns a Retargeter renaming the realname label of the plain label map found at
+// path (like the selector of a Service) when it names a rotated StatefulSet.
+func RetargetLabels(path ...string) Retargeter {
+	return func(obj *unstructured.Unstructured, realNames map[string]string) (bool, error) {
+		labels, found, err := unstructured.NestedStringMap(obj.Object, path...)
+		if err != nil || !found {
+			return false, err
+		}
+		name, pinned := labels[realNameLabel]
+		realName, ok := realNames[name]
+		if !pinned || !ok || realName == name {
+			return false, nil
+		}
+		labels[realNameLabel] = realName
+		return true, unstructured.SetNestedStringMap(obj.Object, labels, path...)
+	}
+}
+
+// RetargetSelector returns a Retargeter renaming the realname label in the matchLabels and
+// matchExpressions of the label selector found at path when it names a rotated StatefulSet.
+func RetargetSelector(path ...string) Retargeter {
+	matchLabels := RetargetLabels(append(path, "matchLabels")...)
+	return func(obj *unstructured.Unstructured, realNames map[string]string) (bool, error) {
+		changed, err := matchLabels(obj, realNames)
+		if err != nil {
+			return false, err
+		}
+		expressions, found, err := unstructured.NestedSlice(obj.Object, append(path, "matchExpressions")...)
+		if err != nil || !found {
+			return changed, err
+		}
+		renamed := false
+		for _, expression := range expressions {
+			e, ok := expression.(map[string]any)
+			if !ok || e["key"] != realNameLabel {
+				continue
+			}
+			values, _ := e["values"].([]any)
+			for i, value := range values {
+				name, _ := value.(string)
+				if realName, ok := realNames[name]; ok && realName != name {
+					values[i] = realName
+					renamed = true
+				}
+			}
+		}
+		if !renamed {
+			return changed, nil
+		}
+		return true, unstructured.SetNestedSlice(obj.Object, expressions, append(path, "matchExpressions")...)
+	}
+}
+
+// retargetNetworkPolicy retargets the pod selector of a NetworkPolicy and those of its ingress and
+// egress peers.
+func retargetNetworkPolicy(obj *unstructured.Unstructured, realNames map[string]string) (bool, error) {
+	changed, err := RetargetSelector("spec", "podSelector")(obj, realNames)
+	if err != nil {
+		return false, err
+	}
+	for _, rule := range []struct{ direction, peers string }{{"ingress", "from"}, {"egress", "to"}} {
+		rules, found, err := unstructured.NestedSlice(obj.Object, "spec", rule.direction)
+		if err != nil || !found {
+			continue
+		}
+		renamed := false
+		for _, r := range rules {
+			rm, ok := r.(map[string]any)
+			if !ok {
+				continue
+			}
+			peers, _ := rm[rule.peers].([]any)
+			for _, peer := range peers {
+				p, ok := peer.(map[string]any)
+				if !ok {
+					continue
+				}
+				did, err := RetargetSelector("podSelector")(&unstructured.Unstructured{Object: p}, realNames)
+				if err != nil {
+					return false, err
+				}
+				renamed = renamed || did
+			}
+		}
+		if renamed {
+			changed = true
+			if err = unstructured.SetNestedSlice(obj.Object, rules, "spec", rule.direction); err != nil {
+				return false, err
+			}
+		}
+	}
+	return changed, nil
+}
+
+// retarget points the references to StatefulSets of r at their rotation with the Retargeter of its
+// kind. It returns r itself when nothing was changed.
+func retarget(r k8s.Resource, realNames map[string]string) (k8s.Resource, bool, error) {
+	retargeter := retargeterOf(r.GetObjectKind().GroupVersionKind().Kind)
+	if retargeter == nil || len(realNames) == 0 {
+		return r, false, nil
+	}
+	u, err := toUnstructured(r)
+	if err != nil {
+		return nil, false, err
+	}
+	if _, ok := r.(*unstructured.Unstructured); ok {
+		u = u.DeepCopy()
+	}
+	var changed bool
+	if changed, err = retargeter(u, realNames); err != nil || !changed {
+		return r, false, err
+	}
+	return u, true, nil
+}
+
+// retargetAll retargets the objects of list in place and returns the keys of those changed.
+func retargetAll(list []k8s.Resource, realNames map[string]string) ([]string, error) {
+	var retargeted []string
+	for i, r := range list {
+		u, changed, err := retarget(r, realNames)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			list[i] = u
+			retargeted = append(retargeted, resourceKey(u.GetObjectKind().GroupVersionKind().Kind, u.GetName()))
+		}
+	}
+	return retargeted, nil
+}
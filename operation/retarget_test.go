@@ -0,0 +1,150 @@
+package operation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zhchang/goquiver/k8s"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const retargetManifest = `
+kind: HorizontalPodAutoscaler
+apiVersion: autoscaling/v2
+metadata:
+  name: db
+spec:
+  scaleTargetRef:
+    apiVersion: apps/v1
+    kind: StatefulSet
+    name: db
+---
+kind: VerticalPodAutoscaler
+apiVersion: autoscaling.k8s.io/v1
+metadata:
+  name: db
+spec:
+  targetRef:
+    apiVersion: apps/v1
+    kind: StatefulSet
+    name: db
+---
+kind: PodDisruptionBudget
+apiVersion: policy/v1
+metadata:
+  name: db
+spec:
+  selector:
+    matchLabels:
+      app: db
+      app.kubernetes.io/realname: db
+    matchExpressions:
+    - key: app.kubernetes.io/realname
+      operator: In
+      values: [db, cache]
+---
+kind: NetworkPolicy
+apiVersion: networking.k8s.io/v1
+metadata:
+  name: db
+spec:
+  podSelector:
+    matchLabels:
+      app.kubernetes.io/realname: db
+  ingress:
+  - from:
+    - podSelector:
+        matchLabels:
+          app.kubernetes.io/realname: cache
+---
+kind: Service
+apiVersion: v1
+metadata:
+  name: db
+spec:
+  selector:
+    app.kubernetes.io/realname: db
+---
+kind: Service
+apiVersion: v1
+metadata:
+  name: web
+spec:
+  selector:
+    app: web
+---
+kind: ConfigMap
+apiVersion: v1
+metadata:
+  name: db`
+
+func TestRetargetAll(t *testing.T) {
+	list, err := k8s.DecodeAllYAML(retargetManifest)
+	assert.NoError(t, err)
+	web := list[5]
+	// an unlabeled selector is not pinned, whatever the names map
+	realNames := map[string]string{"db": "db---2", "cache": "cache---0", "": "db---2"}
+	retargeted, err := retargetAll(list, realNames)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		resourceKey(k8s.KindHorizontalPodAutoscaler, "db"),
+		resourceKey("VerticalPodAutoscaler", "db"),
+		resourceKey(k8s.KindPodDisruptionBudget, "db"),
+		resourceKey("NetworkPolicy", "db"),
+		resourceKey(k8s.KindService, "db"),
+	}, retargeted)
+	assert.Same(t, web, list[5])
+
+	get := func(i int, path ...string) any {
+		value, _, err := unstructured.NestedFieldNoCopy(list[i].(*unstructured.Unstructured).Object, path...)
+		assert.NoError(t, err)
+		return value
+	}
+	assert.Equal(t, "db---2", get(0, "spec", "scaleTargetRef", "name"))
+	assert.Equal(t, "db---2", get(1, "spec", "targetRef", "name"))
+	assert.Equal(t, "db---2", get(2, "spec", "selector", "matchLabels", realNameLabel))
+	assert.Equal(t, "db", get(2, "spec", "selector", "matchLabels", "app"))
+	assert.Equal(t, []any{"db---2", "cache---0"}, get(2, "spec", "selector", "matchExpressions").([]any)[0].(map[string]any)["values"])
+	assert.Equal(t, "db---2", get(3, "spec", "podSelector", "matchLabels", realNameLabel))
+	peer := get(3, "spec", "ingress").([]any)[0].(map[string]any)["from"].([]any)[0].(map[string]any)
+	assert.Equal(t, "cache---0", peer["podSelector"].(map[string]any)["matchLabels"].(map[string]any)[realNameLabel])
+	assert.Equal(t, "db---2", get(4, "spec", "selector", realNameLabel))
+}
+
+func TestRetargetKeepsOriginal(t *testing.T) {
+	list, err := k8s.DecodeAllYAML(retargetManifest)
+	assert.NoError(t, err)
+	retargeted, changed, err := retarget(list[0], map[string]string{"db": "db---1"})
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.NotSame(t, list[0], retargeted)
+	name, _, _ := unstructured.NestedString(list[0].(*unstructured.Unstructured).Object, "spec", "scaleTargetRef", "name")
+	assert.Equal(t, "db", name)
+
+	_, changed, err = retarget(list[0], map[string]string{"db": "db"})
+	assert.NoError(t, err)
+	assert.False(t, changed)
+}
+
+func TestRegisterRetargeter(t *testing.T) {
+	defer RegisterRetargeter("ScaledObject", nil)
+	RegisterRetargeter("ScaledObject", RetargetRef("spec", "scaleTargetRef"))
+	list, err := k8s.DecodeAllYAML(`
+kind: ScaledObject
+apiVersion: keda.sh/v1alpha1
+metadata:
+  name: db
+spec:
+  scaleTargetRef:
+    kind: StatefulSet
+    name: db`)
+	assert.NoError(t, err)
+	retargeted, err := retargetAll(list, map[string]string{"db": "db---3"})
+	assert.NoError(t, err)
+	assert.Len(t, retargeted, 1)
+	name, _, _ := unstructured.NestedString(list[0].(*unstructured.Unstructured).Object, "spec", "scaleTargetRef", "name")
+	assert.Equal(t, "db---3", name)
+
+	RegisterRetargeter("ScaledObject", nil)
+	assert.Nil(t, retargeterOf("ScaledObject"))
+}
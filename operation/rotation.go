@@ -0,0 +1,267 @@
+package operation
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/nextbillion-ai/goreman-util/global"
+	"github.com/zhchang/goquiver/k8s"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// WithDryRun makes ForceRotate and GCRotations only report what they would do.
+func WithDryRun() OperationOption {
+	return func(opts *operationOptions) {
+		opts.dryRun = true
+	}
+}
+
+// RotationChange describes what ForceRotate or GCRotations did, or would do with WithDryRun, to a
+// StatefulSet.
+//
+// Fields:
+// StatefulSet: The name of the StatefulSet in the manifest.
+// Created: The rotation created, if any.
+// Removed: The rotations removed.
+// DryRun: Whether nothing was changed, see WithDryRun.
+type RotationChange struct {
+	StatefulSet string
+	Created     string
+	Removed     []string
+	DryRun      bool
+}
+
+func (c *RotationChange) String() string {
+	var parts []string
+	if c.Created != "" {
+		parts = append(parts, "create "+c.Created)
+	}
+	if len(c.Removed) > 0 {
+		parts = append(parts, "remove "+strings.Join(c.Removed, ", "))
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "nothing to do")
+	}
+	prefix := ""
+	if c.DryRun {
+		prefix = "[dry-run] "
+	}
+	return fmt.Sprintf("%s%s: %s", prefix, c.StatefulSet, strings.Join(parts, "; "))
+}
+
+// recordedStatefulSet returns the manifest ConfigMap of the named resource and the StatefulSet sts
+// recorded in it.
+func recordedStatefulSet(rc global.ResourceContext, name, sts string) (*k8s.ConfigMap, []k8s.Resource, *k8s.StatefulSet, error) {
+	cfg, err := getManifestConfigMap(rc.Context(), name, rc.Namespace())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var recorded []k8s.Resource
+	if recorded, err = k8s.DecodeAllYAML(cfg.Data[manifestKey]); err != nil {
+		return nil, nil, nil, err
+	}
+	for _, r := range recorded {
+		if r.GetObjectKind().GroupVersionKind().Kind == k8s.KindStatefulSet && r.GetName() == sts {
+			var parsed *k8s.StatefulSet
+			if parsed, err = k8s.Parse[*k8s.StatefulSet](r); err != nil {
+				return nil, nil, nil, err
+			}
+			return cfg, recorded, parsed, nil
+		}
+	}
+	return nil, nil, nil, fmt.Errorf("statefulset %s not found in the manifest of %s", sts, name)
+}
+
+// ForceRotate replaces the StatefulSet sts of the named resource with a new rotation `sts---N+1`
+// built from the recorded manifest. Once the new rotation is ready (within the wait,
+// DefaultBlueGreenTimeout when not set), the objects referring to it are retargeted, the Services
+// pinned to the previous rotation by a blue/green rollout are pinned to it and the previous rotations
+// are removed. A new rotation that does not become ready is removed. StatefulSets with a pending
+// blue/green rotation must be promoted or aborted first.
+func ForceRotate(rc global.ResourceContext, name, sts string, options ...OperationOption) (*RotationChange, error) {
+	opts := &operationOptions{}
+	for _, opt := range options {
+		opt(opts)
+	}
+	if opts.result == nil {
+		opts.result = &Result{}
+	}
+	cfg, recorded, parsed, err := recordedStatefulSet(rc, name, sts)
+	if err != nil {
+		return nil, err
+	}
+	if slices.ContainsFunc(blueGreenFromData(cfg.Data), func(s *BlueGreenRotation) bool { return s.StatefulSet == sts }) {
+		return nil, fmt.Errorf("blue/green rotation of %s is pending, promote or abort it first", sts)
+	}
+	current := getCurrentRotation(rc.Context(), sts, rc.Namespace())
+	if current == nil {
+		return nil, fmt.Errorf("no current rotation found for %s", sts)
+	}
+	var next int
+	if next, err = current.next(); err != nil {
+		return nil, err
+	}
+	change := &RotationChange{StatefulSet: sts, Created: sts + "---" + strconv.Itoa(next), Removed: current.names, DryRun: opts.dryRun}
+	rc.Logger().Info(change.String())
+	if opts.dryRun {
+		return change, nil
+	}
+	owner := &ownership{name: name, record: recordFromData(cfg.Data)}
+	setRotationName(parsed, change.Created)
+	if parsed.Namespace == "" {
+		parsed.Namespace = rc.Namespace()
+	}
+	var clone *volumeClone
+	if clone, err = cloneFrom(parsed); err != nil {
+		return nil, err
+	}
+	if clone != nil {
+		if err = opts.cloneVolumes(rc, []*volumeClone{clone}); err != nil {
+			return nil, err
+		}
+	}
+	var r k8s.Resource
+	if r, err = owner.stamp(parsed); err != nil {
+		return nil, err
+	}
+	if err = applyObject(rc, r, opts); err != nil {
+		return nil, err
+	}
+	timeout := opts.wait
+	if timeout <= 0 {
+		timeout = DefaultBlueGreenTimeout
+	}
+	if err = waitReady(rc.Context(), k8s.KindStatefulSet, change.Created, rc.Namespace(), timeout); err != nil {
+		rc.Logger().Warnf("rotation %s is not ready, keeping %s: %s", change.Created, strings.Join(current.names, ", "), err)
+		opts.remove(rc, k8s.KindStatefulSet, change.Created, rc.Namespace(), timeout)
+		return nil, fmt.Errorf("rotation %s is not ready: %w", change.Created, err)
+	}
+	if err = applyRetargeted(rc, recorded, map[string]string{sts: change.Created}, opts, owner); err != nil {
+		return nil, err
+	}
+	if err = applyPinnedServices(rc, pinnedTo(rc, recorded, sts), func(string) string { return change.Created }, opts, owner); err != nil {
+		return nil, err
+	}
+	for _, old := range current.names {
+		opts.remove(rc, k8s.KindStatefulSet, old, rc.Namespace(), opts.wait)
+	}
+	if failed := opts.result.FailedRemovals(); len(failed) > 0 {
+		return change, &RemovalError{Failed: failed}
+	}
+	return change, nil
+}
+
+// pinnedTo returns the StatefulSets stss of the manifest and the Services of the manifest whose
+// live selector is pinned to a rotation, see pinServices.
+func pinnedTo(rc global.ResourceContext, manifest []k8s.Resource, stss ...string) []k8s.Resource {
+	var list []k8s.Resource
+	for _, r := range manifest {
+		switch r.GetObjectKind().GroupVersionKind().Kind {
+		case k8s.KindStatefulSet:
+			if slices.Contains(stss, r.GetName()) {
+				list = append(list, r)
+			}
+		case k8s.KindService:
+			namespace := r.GetNamespace()
+			if namespace == "" {
+				namespace = rc.Namespace()
+			}
+			live, err := getLive(rc.Context(), k8s.KindService, r.GetName(), namespace)
+			if err != nil {
+				continue
+			}
+			if svc, err := k8s.Parse[*k8s.Service](live); err == nil && svc.Spec.Selector[realNameLabel] != "" {
+				list = append(list, r)
+			}
+		}
+	}
+	return list
+}
+
+// applyRetargeted applies the objects of list that refer to a StatefulSet of realNames, pointed at
+// its real name, see RegisterRetargeter.
+func applyRetargeted(rc global.ResourceContext, list []k8s.Resource, realNames map[string]string, opts *operationOptions, owner *ownership) error {
+	for _, r := range list {
+		if r.GetObjectKind().GroupVersionKind().Kind == k8s.KindStatefulSet {
+			continue
+		}
+		r, changed, err := retarget(r, realNames)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			continue
+		}
+		if u, ok := r.(*unstructured.Unstructured); ok && u.GetNamespace() == "" {
+			u.SetNamespace(rc.Namespace())
+		}
+		if r, err = owner.stamp(r); err != nil {
+			return err
+		}
+		if err = applyObject(rc, r, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GCRotations removes every rotation but the current one of the StatefulSets of the named resource.
+// Blue/green rotations whose previous rotation is removed are promoted.
+func GCRotations(rc global.ResourceContext, name string, options ...OperationOption) ([]*RotationChange, error) {
+	opts := &operationOptions{}
+	for _, opt := range options {
+		opt(opts)
+	}
+	if opts.result == nil {
+		opts.result = &Result{}
+	}
+	cfg, err := getManifestConfigMap(rc.Context(), name, rc.Namespace())
+	if err != nil {
+		return nil, err
+	}
+	var recorded []k8s.Resource
+	if recorded, err = k8s.DecodeAllYAML(cfg.Data[manifestKey]); err != nil {
+		return nil, err
+	}
+	var changes []*RotationChange
+	var removed []string
+	for _, r := range recorded {
+		if r.GetObjectKind().GroupVersionKind().Kind != k8s.KindStatefulSet {
+			continue
+		}
+		current := getCurrentRotation(rc.Context(), r.GetName(), rc.Namespace())
+		if current == nil {
+			continue
+		}
+		newest := r.GetName() + "---" + strconv.Itoa(current.rotation)
+		change := &RotationChange{StatefulSet: r.GetName(), DryRun: opts.dryRun}
+		for _, rotation := range current.names {
+			if rotation != newest {
+				change.Removed = append(change.Removed, rotation)
+			}
+		}
+		rc.Logger().Info(change.String())
+		changes = append(changes, change)
+		if opts.dryRun {
+			continue
+		}
+		for _, rotation := range change.Removed {
+			opts.remove(rc, k8s.KindStatefulSet, rotation, rc.Namespace(), opts.wait)
+			if opts.result.Removals[len(opts.result.Removals)-1].Err == nil {
+				removed = append(removed, rotation)
+			}
+		}
+	}
+	if rotations := blueGreenFromData(cfg.Data); len(removed) > 0 && len(rotations) > 0 {
+		rotations = slices.DeleteFunc(rotations, func(s *BlueGreenRotation) bool { return slices.Contains(removed, s.Previous) })
+		if err = updateBlueGreen(rc, cfg, rotations); err != nil {
+			return changes, err
+		}
+	}
+	if failed := opts.result.FailedRemovals(); len(failed) > 0 {
+		return changes, &RemovalError{Failed: failed}
+	}
+	return changes, nil
+}
@@ -0,0 +1,184 @@
+package operation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nextbillion-ai/goreman-util/global"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhchang/goquiver/k8s"
+)
+
+const rotationManifest = `
+kind: StatefulSet
+apiVersion: apps/v1
+metadata:
+  name: db
+spec:
+  template:
+    metadata:
+      labels:
+        app: db
+---
+kind: HorizontalPodAutoscaler
+apiVersion: autoscaling/v2
+metadata:
+  name: db
+spec:
+  scaleTargetRef:
+    apiVersion: apps/v1
+    kind: StatefulSet
+    name: db
+---
+kind: StatefulSet
+apiVersion: apps/v1
+metadata:
+  name: cache
+spec:
+  template:
+    metadata:
+      labels:
+        app: cache
+---
+kind: Service
+apiVersion: v1
+metadata:
+  name: db
+spec:
+  selector:
+    app: db
+---
+kind: Service
+apiVersion: v1
+metadata:
+  name: db-headless
+spec:
+  clusterIP: None
+  selector:
+    app: db`
+
+func setupRotationTest(t *testing.T) func() {
+	getManifestConfigMapOrg := getManifestConfigMap
+	getCurrentRotationOrg := getCurrentRotation
+	getLiveOrg := getLive
+	doRolloutOrg := doRollout
+	doRemoveOrg := doRemove
+	getManifestConfigMap = func(ctx context.Context, name, namespace string) (*k8s.ConfigMap, error) {
+		data, _ := blueGreenData([]*BlueGreenRotation{{StatefulSet: "cache", Previous: "cache---1", Current: "cache---2"}})
+		data[manifestKey] = rotationManifest
+		return &k8s.ConfigMap{Data: data}, nil
+	}
+	getCurrentRotation = func(ctx context.Context, name, namespace string) *currentRotations {
+		switch name {
+		case "db":
+			return &currentRotations{rotation: 3, names: []string{"db---3"}}
+		default:
+			return &currentRotations{rotation: 2, names: []string{"cache---0", "cache---1", "cache---2"}}
+		}
+	}
+	return func() {
+		getManifestConfigMap = getManifestConfigMapOrg
+		getCurrentRotation = getCurrentRotationOrg
+		getLive = getLiveOrg
+		doRollout = doRolloutOrg
+		doRemove = doRemoveOrg
+	}
+}
+
+func TestForceRotate(t *testing.T) {
+	defer setupRotationTest(t)()
+	ready := true
+	getLive = func(ctx context.Context, kind k8s.Kind, name, namespace string) (k8s.Resource, error) {
+		if kind == k8s.KindService {
+			svc := &k8s.Service{}
+			svc.Spec.Selector = map[string]string{"app": "db"}
+			if name == "db" {
+				svc.Spec.Selector[realNameLabel] = "db---3"
+			}
+			return svc, nil
+		}
+		sts := &k8s.StatefulSet{}
+		if ready {
+			sts.Status.ReadyReplicas, sts.Status.AvailableReplicas, sts.Status.UpdatedReplicas = 1, 1, 1
+		}
+		return sts, nil
+	}
+	applied := map[string]k8s.Resource{}
+	doRollout = func(ctx context.Context, item k8s.Resource, options ...k8s.OperationOption) error {
+		applied[item.GetObjectKind().GroupVersionKind().Kind+item.GetName()] = item
+		return nil
+	}
+	var removed []string
+	doRemove = func(ctx context.Context, name, namespace string, kind k8s.Kind, options ...k8s.OperationOption) error {
+		removed = append(removed, name)
+		return nil
+	}
+	rc := global.NewContext(context.Background(), global.WithNamespace("ns"), global.WithLogLevel(logrus.ErrorLevel))
+
+	change, err := ForceRotate(rc, "app", "db", WithDryRun())
+	assert.NoError(t, err)
+	assert.Equal(t, "[dry-run] db: create db---4; remove db---3", change.String())
+	assert.Empty(t, applied)
+	assert.Empty(t, removed)
+
+	change, err = ForceRotate(rc, "app", "db")
+	assert.NoError(t, err)
+	assert.Equal(t, "db: create db---4; remove db---3", change.String())
+	assert.Equal(t, "ns", applied[k8s.KindStatefulSet+"db---4"].GetNamespace())
+	hpa, err := k8s.Parse[*k8s.HorizontalPodAutoscaler](applied[k8s.KindHorizontalPodAutoscaler+"db"])
+	assert.NoError(t, err)
+	assert.Equal(t, "db---4", hpa.Spec.ScaleTargetRef.Name)
+	assert.Equal(t, "db---4", selectorOf(t, applied[k8s.KindService+"db"])[realNameLabel])
+	assert.NotContains(t, applied, k8s.KindService+"db-headless")
+	assert.Equal(t, []string{"db---3"}, removed)
+
+	ready = false
+	applied = map[string]k8s.Resource{}
+	removed = nil
+	_, err = ForceRotate(rc, "app", "db", WithWait(10*time.Millisecond))
+	assert.ErrorContains(t, err, "rotation db---4 is not ready")
+	assert.Equal(t, []string{"db---4"}, removed)
+	assert.NotContains(t, applied, k8s.KindHorizontalPodAutoscaler+"db")
+	assert.NotContains(t, applied, k8s.KindService+"db")
+
+	_, err = ForceRotate(rc, "app", "cache")
+	assert.ErrorContains(t, err, "blue/green rotation of cache is pending")
+
+	_, err = ForceRotate(rc, "app", "missing")
+	assert.ErrorContains(t, err, "statefulset missing not found")
+}
+
+func TestGCRotations(t *testing.T) {
+	defer setupRotationTest(t)()
+	applied := map[string]k8s.Resource{}
+	doRollout = func(ctx context.Context, item k8s.Resource, options ...k8s.OperationOption) error {
+		applied[item.GetObjectKind().GroupVersionKind().Kind+item.GetName()] = item
+		return nil
+	}
+	var removed []string
+	doRemove = func(ctx context.Context, name, namespace string, kind k8s.Kind, options ...k8s.OperationOption) error {
+		removed = append(removed, name)
+		if name == "cache---0" {
+			return errors.New("forbidden")
+		}
+		return nil
+	}
+	rc := global.NewContext(context.Background(), global.WithNamespace("ns"), global.WithLogLevel(logrus.ErrorLevel))
+
+	changes, err := GCRotations(rc, "app", WithDryRun())
+	assert.NoError(t, err)
+	assert.Len(t, changes, 2)
+	assert.Equal(t, "[dry-run] db: nothing to do", changes[0].String())
+	assert.Equal(t, "[dry-run] cache: remove cache---0, cache---1", changes[1].String())
+	assert.Empty(t, removed)
+
+	_, err = GCRotations(rc, "app")
+	var removalErr *RemovalError
+	assert.True(t, errors.As(err, &removalErr))
+	assert.Equal(t, "cache---0", removalErr.Failed[0].Name)
+	assert.Equal(t, []string{"cache---0", "cache---1"}, removed)
+	assert.NotContains(t, applied[k8s.KindConfigMap].(*k8s.ConfigMap).Data, blueGreenKey)
+}
@@ -0,0 +1,210 @@
+package operation
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/nextbillion-ai/goreman-util/global"
+	"github.com/zhchang/goquiver/k8s"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// WorkloadStatus reports the readiness of a workload (Deployment, StatefulSet or DaemonSet).
+// Name is the live name of the workload, i.e. the current rotation for StatefulSets.
+type WorkloadStatus struct {
+	Kind          k8s.Kind
+	Name          string
+	Replicas      int32
+	ReadyReplicas int32
+	Ready         bool
+	Err           error
+}
+
+// ResourceStatus describes what is deployed for a resource.
+//
+// Fields:
+// Record: The asset, values hash and deploy time recorded by the last rollout.
+// Rotations: The current rotation number of every rotated StatefulSet, keyed by its name in the manifest.
+// Workloads: The readiness of every workload of the stored manifest.
+type ResourceStatus struct {
+	Name      string
+	Namespace string
+	Record    *Record
+	Rotations map[string]int
+	Workloads []*WorkloadStatus
+}
+
+// Ready reports whether every workload of the resource is ready.
+func (s *ResourceStatus) Ready() bool {
+	for _, w := range s.Workloads {
+		if !w.Ready {
+			return false
+		}
+	}
+	return true
+}
+
+func isWorkload(kind k8s.Kind) bool {
+	return kind == k8s.KindDeployment || kind == k8s.KindStatefulSet || kind == k8s.KindDaemonSet
+}
+
+// workloadStatus fetches a workload and reports whether all of its replicas are updated and ready.
+func workloadStatus(ctx context.Context, kind k8s.Kind, name, namespace string) *WorkloadStatus {
+	ws := &WorkloadStatus{Kind: kind, Name: name}
+	var live k8s.Resource
+	if live, ws.Err = getLive(ctx, kind, name, namespace); ws.Err != nil {
+		return ws
+	}
+	switch v := live.(type) {
+	case *k8s.Deployment:
+		ws.Replicas = 1
+		if v.Spec.Replicas != nil {
+			ws.Replicas = *v.Spec.Replicas
+		}
+		ws.ReadyReplicas = v.Status.ReadyReplicas
+		ws.Ready = v.Status.ObservedGeneration >= v.Generation &&
+			v.Status.ReadyReplicas == ws.Replicas &&
+			v.Status.AvailableReplicas == ws.Replicas &&
+			v.Status.UpdatedReplicas == ws.Replicas
+	case *k8s.StatefulSet:
+		ws.Replicas = 1
+		if v.Spec.Replicas != nil {
+			ws.Replicas = *v.Spec.Replicas
+		}
+		ws.ReadyReplicas = v.Status.ReadyReplicas
+		ws.Ready = v.Status.ObservedGeneration >= v.Generation &&
+			v.Status.ReadyReplicas == ws.Replicas &&
+			v.Status.AvailableReplicas == ws.Replicas &&
+			v.Status.UpdatedReplicas == ws.Replicas
+	case *k8s.DaemonSet:
+		ws.Replicas = v.Status.DesiredNumberScheduled
+		ws.ReadyReplicas = v.Status.NumberReady
+		ws.Ready = v.Status.ObservedGeneration >= v.Generation &&
+			v.Status.NumberReady == ws.Replicas &&
+			v.Status.UpdatedNumberScheduled == ws.Replicas
+	default:
+		ws.Err = fmt.Errorf("%s is not a workload", kind)
+	}
+	return ws
+}
+
+// Status describes what is deployed for the named resource in the namespace of rc: the record of
+// the last rollout, the current StatefulSet rotations and the readiness of every workload.
+func Status(rc global.ResourceContext, name string) (*ResourceStatus, error) {
+	var err error
+	var cfg *k8s.ConfigMap
+	if cfg, err = getManifestConfigMap(rc.Context(), name, rc.Namespace()); err != nil {
+		return nil, err
+	}
+	return resourceStatus(rc.Context(), cfg, name, rc.Namespace())
+}
+
+func resourceStatus(ctx context.Context, cfg *k8s.ConfigMap, name, namespace string) (*ResourceStatus, error) {
+	var err error
+	var recorded []k8s.Resource
+	if recorded, err = k8s.DecodeAllYAML(cfg.Data[manifestKey]); err != nil {
+		return nil, err
+	}
+	status := &ResourceStatus{
+		Name:      name,
+		Namespace: namespace,
+		Record:    recordFromData(cfg.Data),
+		Rotations: map[string]int{},
+	}
+	for _, r := range recorded {
+		kind := r.GetObjectKind().GroupVersionKind().Kind
+		if !isWorkload(kind) {
+			continue
+		}
+		workloadName := r.GetName()
+		if kind == k8s.KindStatefulSet {
+			if current := getCurrentRotation(ctx, r.GetName(), namespace); current != nil {
+				status.Rotations[r.GetName()] = current.rotation
+				workloadName = current.names[len(current.names)-1]
+			}
+		}
+		status.Workloads = append(status.Workloads, workloadStatus(ctx, kind, workloadName, namespace))
+	}
+	return status, nil
+}
+
+// Summary describes a managed resource found by List.
+//
+// Fields:
+// Labels: The ownership labels of the resource, see LabelManagedBy and the other Label constants.
+// Record: The asset, values hash and deploy time recorded by the last rollout.
+// Ready: Whether every workload of the resource is ready.
+// Err: The error met while checking the readiness of the resource, if any.
+type Summary struct {
+	Name      string
+	Namespace string
+	Labels    map[string]string
+	Record    *Record
+	Ready     bool
+	Err       error
+}
+
+var manifestNameRegex = regexp.MustCompile(`-manifest$`)
+
+var listManifestConfigMaps = func(ctx context.Context, namespace string) ([]*k8s.ConfigMap, error) {
+	return k8s.List[*k8s.ConfigMap](ctx, namespace, k8s.WithRegex(manifestNameRegex))
+}
+
+// List returns every resource managed by goreman-util in the namespace of rc, or in all namespaces
+// if rc has no namespace, whose ownership labels match selector (a label selector such as
+// `foreman/asset-type=service`; an empty selector matches everything). Manifests written before
+// ownership labels existed are matched against the labels they would carry.
+func List(rc global.ResourceContext, selector string) ([]*Summary, error) {
+	var err error
+	var sel labels.Selector
+	if sel, err = labels.Parse(selector); err != nil {
+		return nil, err
+	}
+	var cfgs []*k8s.ConfigMap
+	if cfgs, err = listManifestConfigMaps(rc.Context(), rc.Namespace()); err != nil {
+		return nil, err
+	}
+	var summaries []*Summary
+	for _, cfg := range cfgs {
+		if _, ok := cfg.Data[manifestKey]; !ok {
+			continue
+		}
+		name := strings.TrimSuffix(cfg.GetName(), "-manifest")
+		lbls := map[string]string{}
+		for key, value := range cfg.GetLabels() {
+			lbls[key] = value
+		}
+		switch lbls[LabelManagedBy] {
+		case ManagedByValue:
+		case "":
+			for key, value := range ownerLabels(name, recordFromData(cfg.Data)) {
+				lbls[key] = value
+			}
+		default:
+			continue
+		}
+		if !sel.Matches(labels.Set(lbls)) {
+			continue
+		}
+		summary := &Summary{Name: name, Namespace: cfg.GetNamespace(), Labels: lbls, Record: recordFromData(cfg.Data)}
+		var status *ResourceStatus
+		if status, summary.Err = resourceStatus(rc.Context(), cfg, name, cfg.GetNamespace()); summary.Err == nil {
+			summary.Ready = status.Ready()
+			for _, w := range status.Workloads {
+				if w.Err != nil {
+					summary.Err = w.Err
+					break
+				}
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+	slices.SortFunc(summaries, func(a, b *Summary) int {
+		return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.Name, b.Name))
+	})
+	return summaries, nil
+}
@@ -0,0 +1,130 @@
+package operation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nextbillion-ai/goreman-util/global"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhchang/goquiver/k8s"
+)
+
+func TestStatus(t *testing.T) {
+	orgGetManifestConfigMap := getManifestConfigMap
+	orgGetCurrentRotation := getCurrentRotation
+	orgGetLive := getLive
+	defer func() {
+		getManifestConfigMap = orgGetManifestConfigMap
+		getCurrentRotation = orgGetCurrentRotation
+		getLive = orgGetLive
+	}()
+	deployTime := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	getManifestConfigMap = func(ctx context.Context, name, namespace string) (*k8s.ConfigMap, error) {
+		cfg := &k8s.ConfigMap{}
+		cfg.Data = (&Record{AssetType: "service", AssetRelease: "v1", ValuesHash: "abc", DeployTime: deployTime}).data()
+		cfg.Data[manifestKey] = `
+kind: StatefulSet
+metadata:
+  name: sts1
+---
+kind: Deployment
+metadata:
+  name: deploy1
+---
+kind: Service
+metadata:
+  name: svc1`
+		return cfg, nil
+	}
+	getCurrentRotation = func(ctx context.Context, name, namespace string) *currentRotations {
+		return &currentRotations{rotation: 4, names: []string{"sts1---3", "sts1---4"}}
+	}
+	replicas := int32(2)
+	getLive = func(ctx context.Context, kind k8s.Kind, name, namespace string) (k8s.Resource, error) {
+		switch kind {
+		case k8s.KindStatefulSet:
+			assert.Equal(t, "sts1---4", name)
+			sts := &k8s.StatefulSet{}
+			sts.Spec.Replicas = &replicas
+			sts.Status.ReadyReplicas, sts.Status.AvailableReplicas, sts.Status.UpdatedReplicas = 2, 2, 2
+			return sts, nil
+		default:
+			deploy := &k8s.Deployment{}
+			deploy.Spec.Replicas = &replicas
+			deploy.Status.ReadyReplicas, deploy.Status.AvailableReplicas, deploy.Status.UpdatedReplicas = 1, 1, 2
+			return deploy, nil
+		}
+	}
+
+	status, err := Status(global.NewContext(context.Background(), global.WithNamespace("ns")), "whocares")
+	assert.NoError(t, err)
+	assert.Equal(t, "service", status.Record.AssetType)
+	assert.Equal(t, "v1", status.Record.AssetRelease)
+	assert.Equal(t, "abc", status.Record.ValuesHash)
+	assert.True(t, deployTime.Equal(status.Record.DeployTime))
+	assert.Equal(t, map[string]int{"sts1": 4}, status.Rotations)
+	assert.Len(t, status.Workloads, 2)
+	assert.True(t, status.Workloads[0].Ready)
+	assert.False(t, status.Workloads[1].Ready)
+	assert.Equal(t, int32(1), status.Workloads[1].ReadyReplicas)
+	assert.False(t, status.Ready())
+}
+
+func TestList(t *testing.T) {
+	orgListManifestConfigMaps := listManifestConfigMaps
+	orgGetLive := getLive
+	defer func() {
+		listManifestConfigMaps = orgListManifestConfigMaps
+		getLive = orgGetLive
+	}()
+	newCfg := func(name, namespace string, labels map[string]string, record *Record) *k8s.ConfigMap {
+		cfg := &k8s.ConfigMap{}
+		cfg.Name, cfg.Namespace, cfg.Labels = name, namespace, labels
+		cfg.Data = record.data()
+		cfg.Data[manifestKey] = "kind: Deployment\nmetadata:\n  name: " + name
+		return cfg
+	}
+	listManifestConfigMaps = func(ctx context.Context, namespace string) ([]*k8s.ConfigMap, error) {
+		assert.Equal(t, "", namespace)
+		foreign := newCfg("other-manifest", "ns1", map[string]string{LabelManagedBy: "helm"}, nil)
+		notManifest := &k8s.ConfigMap{}
+		notManifest.Name = "plain-manifest"
+		return []*k8s.ConfigMap{
+			newCfg("worker-manifest", "ns2", ownerLabels("worker", &Record{AssetType: "worker", AssetRelease: "v2"}), &Record{AssetType: "worker", AssetRelease: "v2"}),
+			newCfg("api-manifest", "ns1", ownerLabels("api", &Record{AssetType: "service", AssetRelease: "v1"}), &Record{AssetType: "service", AssetRelease: "v1"}),
+			newCfg("legacy-manifest", "ns1", nil, nil),
+			foreign,
+			notManifest,
+		}, nil
+	}
+	replicas := int32(1)
+	getLive = func(ctx context.Context, kind k8s.Kind, name, namespace string) (k8s.Resource, error) {
+		deploy := &k8s.Deployment{}
+		deploy.Spec.Replicas = &replicas
+		if name != "legacy-manifest" {
+			deploy.Status.ReadyReplicas, deploy.Status.AvailableReplicas, deploy.Status.UpdatedReplicas = 1, 1, 1
+		}
+		return deploy, nil
+	}
+	rc := global.NewContext(context.Background())
+
+	summaries, err := List(rc, "")
+	assert.NoError(t, err)
+	assert.Len(t, summaries, 3)
+	assert.Equal(t, "api", summaries[0].Name)
+	assert.Equal(t, "v1", summaries[0].Record.AssetRelease)
+	assert.True(t, summaries[0].Ready)
+	assert.Equal(t, "legacy", summaries[1].Name)
+	assert.Equal(t, "legacy", summaries[1].Labels[LabelResource])
+	assert.False(t, summaries[1].Ready)
+	assert.Equal(t, "worker", summaries[2].Name)
+
+	summaries, err = List(rc, LabelAssetType+"=worker")
+	assert.NoError(t, err)
+	assert.Len(t, summaries, 1)
+	assert.Equal(t, "ns2", summaries[0].Namespace)
+
+	_, err = List(rc, "!!")
+	assert.Error(t, err)
+}
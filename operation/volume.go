@@ -0,0 +1,231 @@
+package operation
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nextbillion-ai/goreman-util/global"
+	"github.com/nextbillion-ai/goreman-util/internal/kube"
+	"github.com/zhchang/goquiver/k8s"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AnnotationVolumePolicy sets what happens to the PersistentVolumeClaims of a StatefulSet rotation
+// when it is removed: VolumeDelete, VolumeRetain or VolumeClone.
+const AnnotationVolumePolicy = "foreman/volume-policy"
+
+// Volume policies.
+const (
+	// VolumeDelete deletes the claims of a removed rotation, it is the default and what removing a
+	// StatefulSet always did.
+	VolumeDelete = "delete"
+	// VolumeRetain keeps the claims of a removed rotation.
+	VolumeRetain = "retain"
+	// VolumeClone clones the claims of the previous rotation into the claims of a new rotation
+	// before it is created, then deletes them with the previous rotation. The storage class must
+	// support volume cloning.
+	VolumeClone = "clone"
+)
+
+// Volume actions reported in VolumeChange.
+const (
+	VolumeDeleted  = "deleted"
+	VolumeRetained = "retained"
+	VolumeCloned   = "cloned"
+)
+
+// VolumeChange is what was done to a PersistentVolumeClaim of a StatefulSet rotation.
+//
+// Fields:
+// StatefulSet: The rotation the claim belongs to.
+// Claim: The name of the claim.
+// Action: VolumeDeleted, VolumeRetained or VolumeCloned.
+// Source: The claim cloned, for VolumeCloned.
+// Err: Why the action failed, nil on success.
+type VolumeChange struct {
+	StatefulSet string
+	Claim       string
+	Action      string
+	Source      string
+	Err         error
+}
+
+// volumePolicy returns the volume policy of sts. Unknown policies retain the claims, so that a typo
+// never deletes data.
+func volumePolicy(sts *k8s.StatefulSet) string {
+	switch policy := strings.ToLower(sts.GetAnnotations()[AnnotationVolumePolicy]); policy {
+	case "", VolumeDelete:
+		return VolumeDelete
+	case VolumeClone:
+		return VolumeClone
+	default:
+		return VolumeRetain
+	}
+}
+
+// getStatefulSet reads a StatefulSet with the clientset, which fails cleanly when no cluster is
+// configured.
+var getStatefulSet = func(ctx context.Context, name, namespace string) (*k8s.StatefulSet, error) {
+	clientset, err := kube.Clientset()
+	if err != nil {
+		return nil, err
+	}
+	return clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+var listClaims = func(ctx context.Context, namespace string) ([]*k8s.PersistentVolumeClaim, error) {
+	return k8s.List[*k8s.PersistentVolumeClaim](ctx, namespace)
+}
+
+// removeStatefulSetOnly deletes a StatefulSet and its pods but not its claims, waiting up to wait
+// for it to be gone.
+var removeStatefulSetOnly = func(ctx context.Context, name, namespace string, wait time.Duration) error {
+	clientset, err := kube.Clientset()
+	if err != nil {
+		return err
+	}
+	propagation := metav1.DeletePropagationBackground
+	if err = clientset.AppsV1().StatefulSets(namespace).Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &propagation}); err != nil || wait <= 0 {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	for {
+		if _, err = clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{}); apierrors.IsNotFound(err) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// claimPattern matches the names of the claims created from the template of sts, one per ordinal.
+func claimPattern(template, sts string) *regexp.Regexp {
+	return regexp.MustCompile(`^` + regexp.QuoteMeta(template+"-"+sts+"-") + `(\d+)$`)
+}
+
+// claimsOf returns the claims of claims created from the volume claim templates of sts.
+func claimsOf(sts *k8s.StatefulSet, claims []*k8s.PersistentVolumeClaim) []*k8s.PersistentVolumeClaim {
+	var owned []*k8s.PersistentVolumeClaim
+	for _, template := range sts.Spec.VolumeClaimTemplates {
+		pattern := claimPattern(template.GetName(), sts.GetName())
+		for _, claim := range claims {
+			if pattern.MatchString(claim.GetName()) {
+				owned = append(owned, claim)
+			}
+		}
+	}
+	slices.SortFunc(owned, func(a, b *k8s.PersistentVolumeClaim) int { return strings.Compare(a.GetName(), b.GetName()) })
+	return owned
+}
+
+// removeStatefulSet removes a StatefulSet rotation and handles its claims according to its volume
+// policy. StatefulSets that cannot be read are removed as any other object.
+func (opts *operationOptions) removeStatefulSet(rc global.ResourceContext, name, namespace string, wait time.Duration) {
+	sts, err := getStatefulSet(rc.Context(), name, namespace)
+	if err != nil || len(sts.Spec.VolumeClaimTemplates) == 0 {
+		opts.removeObject(rc, k8s.KindStatefulSet, name, namespace, wait)
+		return
+	}
+	all, err := listClaims(rc.Context(), namespace)
+	if err != nil {
+		rc.Logger().Warnf("failed to list the claims of %s/%s: %s", namespace, name, err)
+	}
+	claims := claimsOf(sts, all)
+	if volumePolicy(sts) == VolumeRetain {
+		removal := Removal{Kind: k8s.KindStatefulSet, Name: name, Namespace: namespace}
+		if removal.Err = removeStatefulSetOnly(rc.Context(), name, namespace, wait); apierrors.IsNotFound(removal.Err) {
+			removal.Err = nil
+		}
+		if removal.Err != nil {
+			rc.Logger().Warnf("failed to remove %s-%s/%s: %s", k8s.KindStatefulSet, namespace, name, removal.Err)
+		}
+		opts.result.Removals = append(opts.result.Removals, removal)
+		if removal.Err != nil {
+			return
+		}
+		for _, claim := range claims {
+			rc.Logger().Infof("retaining claim %s/%s of %s", namespace, claim.GetName(), name)
+			opts.result.Volumes = append(opts.result.Volumes, VolumeChange{StatefulSet: name, Claim: claim.GetName(), Action: VolumeRetained})
+		}
+		return
+	}
+	// removing a StatefulSet deletes its claims
+	opts.removeObject(rc, k8s.KindStatefulSet, name, namespace, wait)
+	if opts.result.Removals[len(opts.result.Removals)-1].Err != nil {
+		return
+	}
+	for _, claim := range claims {
+		opts.result.Volumes = append(opts.result.Volumes, VolumeChange{StatefulSet: name, Claim: claim.GetName(), Action: VolumeDeleted})
+	}
+}
+
+// volumeClone is the cloning of the claims of the rotation from into those of the rotation to.
+type volumeClone struct {
+	from string
+	to   *k8s.StatefulSet
+}
+
+// cloneFrom returns the clone of the claims of the rotation preceding sts, if sts has the clone
+// volume policy.
+func cloneFrom(sts k8s.Resource) (*volumeClone, error) {
+	to, err := k8s.Parse[*k8s.StatefulSet](sts)
+	if err != nil || volumePolicy(to) != VolumeClone || len(to.Spec.VolumeClaimTemplates) == 0 {
+		return nil, err
+	}
+	rotation, err := extractRotation(to.GetName())
+	if err != nil || rotation == 0 {
+		return nil, nil
+	}
+	return &volumeClone{from: strings.TrimSuffix(to.GetName(), strconv.Itoa(rotation)) + strconv.Itoa(rotation-1), to: to}, nil
+}
+
+// cloneVolumes creates the claims of the new rotations from their volume claim templates with the
+// claims of the previous rotations as data source, so that the StatefulSet controller adopts them
+// instead of provisioning empty volumes.
+func (opts *operationOptions) cloneVolumes(rc global.ResourceContext, clones []*volumeClone) error {
+	if len(clones) == 0 {
+		return nil
+	}
+	all, err := listClaims(rc.Context(), rc.Namespace())
+	if err != nil {
+		return err
+	}
+	for _, clone := range clones {
+		for _, template := range clone.to.Spec.VolumeClaimTemplates {
+			pattern := claimPattern(template.GetName(), clone.from)
+			for _, source := range all {
+				matches := pattern.FindStringSubmatch(source.GetName())
+				if matches == nil {
+					continue
+				}
+				claim := &k8s.PersistentVolumeClaim{}
+				claim.Kind = k8s.KindPersistentVolumeClaim
+				claim.APIVersion = "v1"
+				claim.Name = template.GetName() + "-" + clone.to.GetName() + "-" + matches[1]
+				claim.Namespace = rc.Namespace()
+				claim.Labels = template.Labels
+				claim.Spec = *template.Spec.DeepCopy()
+				claim.Spec.DataSourceRef = nil
+				claim.Spec.DataSource = &corev1.TypedLocalObjectReference{Kind: k8s.KindPersistentVolumeClaim, Name: source.GetName()}
+				change := VolumeChange{StatefulSet: clone.to.GetName(), Claim: claim.Name, Action: VolumeCloned, Source: source.GetName()}
+				change.Err = doRollout(rc.Context(), claim)
+				opts.result.Volumes = append(opts.result.Volumes, change)
+				if change.Err != nil {
+					return change.Err
+				}
+				rc.Logger().Infof("cloned claim %s into %s", source.GetName(), claim.Name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package operation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nextbillion-ai/goreman-util/global"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhchang/goquiver/k8s"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func volumeSts(name, policy string) *k8s.StatefulSet {
+	sts := &k8s.StatefulSet{}
+	sts.Kind = k8s.KindStatefulSet
+	sts.Name = name
+	if policy != "" {
+		sts.Annotations = map[string]string{AnnotationVolumePolicy: policy}
+	}
+	template := k8s.PersistentVolumeClaim{}
+	template.Name = "data"
+	template.Spec.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+	template.Spec.Resources.Requests = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("20Gi")}
+	sts.Spec.VolumeClaimTemplates = append(sts.Spec.VolumeClaimTemplates, template)
+	return sts
+}
+
+func setupVolumeTest(t *testing.T) func() {
+	getStatefulSetOrg := getStatefulSet
+	listClaimsOrg := listClaims
+	doRolloutOrg := doRollout
+	doRemoveOrg := doRemove
+	removeStatefulSetOnlyOrg := removeStatefulSetOnly
+	listClaims = func(ctx context.Context, namespace string) ([]*k8s.PersistentVolumeClaim, error) {
+		var claims []*k8s.PersistentVolumeClaim
+		for _, name := range []string{"data-db---1-1", "data-db---1-0", "data-db---10-0", "data-my-db---1-0", "logs-db---1-0"} {
+			claim := &k8s.PersistentVolumeClaim{}
+			claim.Name = name
+			claim.Spec.VolumeName = "pv-" + name
+			claim.Spec.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany}
+			claim.Spec.Resources.Requests = corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")}
+			claims = append(claims, claim)
+		}
+		return claims, nil
+	}
+	return func() {
+		getStatefulSet = getStatefulSetOrg
+		listClaims = listClaimsOrg
+		doRollout = doRolloutOrg
+		doRemove = doRemoveOrg
+		removeStatefulSetOnly = removeStatefulSetOnlyOrg
+	}
+}
+
+func TestRemoveStatefulSetVolumes(t *testing.T) {
+	defer setupVolumeTest(t)()
+	var policy string
+	getStatefulSet = func(ctx context.Context, name, namespace string) (*k8s.StatefulSet, error) {
+		return volumeSts(name, policy), nil
+	}
+	var removed, orphaned []string
+	doRemove = func(ctx context.Context, name, namespace string, kind k8s.Kind, options ...k8s.OperationOption) error {
+		removed = append(removed, kind+"/"+name)
+		return nil
+	}
+	removeStatefulSetOnly = func(ctx context.Context, name, namespace string, wait time.Duration) error {
+		orphaned = append(orphaned, name)
+		return nil
+	}
+	rc := global.NewContext(context.Background(), global.WithNamespace("ns"), global.WithLogLevel(logrus.ErrorLevel))
+
+	opts := &operationOptions{result: &Result{}}
+	opts.remove(rc, k8s.KindStatefulSet, "db---1", "ns", 0)
+	assert.Equal(t, []string{"StatefulSet/db---1"}, removed)
+	assert.Empty(t, orphaned)
+	assert.Equal(t, []Removal{{Kind: k8s.KindStatefulSet, Name: "db---1", Namespace: "ns"}}, opts.result.Removals)
+	assert.Equal(t, []VolumeChange{
+		{StatefulSet: "db---1", Claim: "data-db---1-0", Action: VolumeDeleted},
+		{StatefulSet: "db---1", Claim: "data-db---1-1", Action: VolumeDeleted},
+	}, opts.result.Volumes)
+
+	for _, policy = range []string{VolumeRetain, "Keep"} {
+		removed, orphaned = nil, nil
+		opts = &operationOptions{result: &Result{}}
+		opts.remove(rc, k8s.KindStatefulSet, "db---1", "ns", 0)
+		assert.Empty(t, removed)
+		assert.Equal(t, []string{"db---1"}, orphaned)
+		assert.Equal(t, []Removal{{Kind: k8s.KindStatefulSet, Name: "db---1", Namespace: "ns"}}, opts.result.Removals)
+		assert.Equal(t, []VolumeChange{
+			{StatefulSet: "db---1", Claim: "data-db---1-0", Action: VolumeRetained},
+			{StatefulSet: "db---1", Claim: "data-db---1-1", Action: VolumeRetained},
+		}, opts.result.Volumes)
+	}
+}
+
+func TestCloneVolumes(t *testing.T) {
+	defer setupVolumeTest(t)()
+	var created []*k8s.PersistentVolumeClaim
+	doRollout = func(ctx context.Context, item k8s.Resource, options ...k8s.OperationOption) error {
+		created = append(created, item.(*k8s.PersistentVolumeClaim))
+		return nil
+	}
+	rc := global.NewContext(context.Background(), global.WithNamespace("ns"), global.WithLogLevel(logrus.ErrorLevel))
+
+	clone, err := cloneFrom(volumeSts("db---0", VolumeClone))
+	assert.NoError(t, err)
+	assert.Nil(t, clone)
+	clone, err = cloneFrom(volumeSts("db---2", VolumeDelete))
+	assert.NoError(t, err)
+	assert.Nil(t, clone)
+	clone, err = cloneFrom(volumeSts("db---2", VolumeClone))
+	assert.NoError(t, err)
+	assert.Equal(t, "db---1", clone.from)
+
+	opts := &operationOptions{result: &Result{}}
+	assert.NoError(t, opts.cloneVolumes(rc, []*volumeClone{clone}))
+	assert.Len(t, created, 2)
+	assert.Equal(t, "data-db---2-1", created[0].Name)
+	assert.Equal(t, "ns", created[0].Namespace)
+	assert.Empty(t, created[0].Spec.VolumeName)
+	assert.Equal(t, []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}, created[0].Spec.AccessModes)
+	assert.Equal(t, "20Gi", created[0].Spec.Resources.Requests.Storage().String())
+	assert.Equal(t, k8s.KindPersistentVolumeClaim, created[0].Spec.DataSource.Kind)
+	assert.Equal(t, "data-db---1-1", created[0].Spec.DataSource.Name)
+	assert.Equal(t, VolumeChange{StatefulSet: "db---2", Claim: "data-db---2-0", Action: VolumeCloned, Source: "data-db---1-0"}, opts.result.Volumes[1])
+}
@@ -0,0 +1,207 @@
+package resource
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nextbillion-ai/goreman-util/global"
+	"github.com/nextbillion-ai/goreman-util/operation"
+)
+
+// Target is a place a fleet rollout deploys the resource to.
+//
+// Fields:
+// Name: Identifies the target in logs and results, the namespace of Context when empty.
+// Context: The resource context of the target, its namespace is where the resource is deployed.
+// Rollout: Deploys the resource to the target instead of Resource.Rollout, e.g. to reach another
+// cluster than the one the process is connected to.
+type Target struct {
+	Name    string
+	Context global.ResourceContext
+	Rollout func(rc global.ResourceContext, name string, spec *global.Spec, options ...ResourceOption) error
+}
+
+func (t *Target) name() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return t.Context.Namespace()
+}
+
+// Status of a target in a fleet rollout.
+const (
+	TargetSucceeded = "succeeded"
+	TargetFailed    = "failed"
+	TargetSkipped   = "skipped"
+)
+
+// TargetResult is the outcome of a fleet rollout on a target.
+//
+// Fields:
+// Target: The name of the target.
+// Wave: The wave the target was rolled out in, starting at 1, 0 when skipped.
+// Status: TargetSucceeded, TargetFailed or TargetSkipped.
+// Err: Why the rollout failed.
+// Result: What the rollout did, see WithResult.
+// Duration: How long the rollout took.
+type TargetResult struct {
+	Target   string
+	Wave     int
+	Status   string
+	Err      error
+	Result   *operation.Result
+	Duration time.Duration
+}
+
+// FleetResult is the outcome of a fleet rollout, with a result per target in the order of the
+// targets.
+type FleetResult struct {
+	Targets []*TargetResult
+}
+
+// Failed returns the results of the targets whose rollout failed.
+func (f *FleetResult) Failed() []*TargetResult {
+	var failed []*TargetResult
+	for _, t := range f.Targets {
+		if t.Status == TargetFailed {
+			failed = append(failed, t)
+		}
+	}
+	return failed
+}
+
+// FleetError is returned when a fleet rollout stopped because more targets failed than its failure
+// budget allows.
+type FleetError struct {
+	Failed  []*TargetResult
+	Skipped int
+}
+
+func (e *FleetError) Error() string {
+	var failed []string
+	for _, t := range e.Failed {
+		failed = append(failed, fmt.Sprintf("%s: %s", t.Target, t.Err))
+	}
+	return fmt.Sprintf("fleet rollout stopped after %d failure(s), %d target(s) skipped: %s", len(e.Failed), e.Skipped, strings.Join(failed, "; "))
+}
+
+type fleetOptions struct {
+	batchSize     int
+	pause         time.Duration
+	failureBudget int
+	options       []ResourceOption
+}
+
+type FleetOption func(*fleetOptions)
+
+// WithBatchSize sets how many targets are rolled out at once in a wave, 1 by default.
+func WithBatchSize(size int) FleetOption {
+	return func(fos *fleetOptions) {
+		fos.batchSize = size
+	}
+}
+
+// WithPause sets how long to wait between two waves.
+func WithPause(pause time.Duration) FleetOption {
+	return func(fos *fleetOptions) {
+		fos.pause = pause
+	}
+}
+
+// WithFailureBudget sets how many targets may fail before the fleet rollout stops, 0 by default:
+// the fleet rollout stops after the wave of the first failure.
+func WithFailureBudget(budget int) FleetOption {
+	return func(fos *fleetOptions) {
+		fos.failureBudget = budget
+	}
+}
+
+// WithTargetOptions sets the options of the rollout on every target. WithResult is ignored, the
+// result of every target is in its TargetResult.
+func WithTargetOptions(options ...ResourceOption) FleetOption {
+	return func(fos *fleetOptions) {
+		fos.options = options
+	}
+}
+
+// rolloutTarget deploys the resource named name to a target with Resource.Rollout.
+var rolloutTarget = func(rc global.ResourceContext, name string, spec *global.Spec, options ...ResourceOption) error {
+	r, err := New(rc, name, spec)
+	if err != nil {
+		return err
+	}
+	return r.Rollout(rc, options...)
+}
+
+// RolloutFleet deploys the resource named name with spec to targets, in waves of the batch size
+// separated by the pause. The targets of a wave are rolled out concurrently. Once more targets
+// failed than the failure budget allows, the remaining waves are skipped and a *FleetError is
+// returned. Cancelling the context of rc skips the waves not started yet.
+func RolloutFleet(rc global.ResourceContext, name string, spec *global.Spec, targets []Target, options ...FleetOption) (*FleetResult, error) {
+	fos := &fleetOptions{batchSize: 1}
+	for _, option := range options {
+		option(fos)
+	}
+	if fos.batchSize < 1 {
+		return nil, fmt.Errorf("invalid batch size: %d", fos.batchSize)
+	}
+	if fos.failureBudget < 0 {
+		return nil, fmt.Errorf("invalid failure budget: %d", fos.failureBudget)
+	}
+	result := &FleetResult{}
+	for i := range targets {
+		if targets[i].Context == nil {
+			return nil, fmt.Errorf("target %d has no resource context", i)
+		}
+		result.Targets = append(result.Targets, &TargetResult{Target: targets[i].name(), Status: TargetSkipped})
+	}
+	failed := 0
+	for start, wave := 0, 1; start < len(targets); start, wave = start+fos.batchSize, wave+1 {
+		if start > 0 && fos.pause > 0 {
+			rc.Logger().Infof("fleet rollout of %s: pausing %s before wave %d", name, fos.pause, wave)
+			select {
+			case <-rc.Context().Done():
+			case <-time.After(fos.pause):
+			}
+		}
+		if err := rc.Context().Err(); err != nil {
+			return result, fmt.Errorf("fleet rollout of %s cancelled before wave %d: %w", name, wave, err)
+		}
+		end := min(start+fos.batchSize, len(targets))
+		rc.Logger().Infof("fleet rollout of %s: wave %d, %d target(s)", name, wave, end-start)
+		var wg sync.WaitGroup
+		for i := start; i < end; i++ {
+			wg.Add(1)
+			go func(target *Target, tr *TargetResult) {
+				defer wg.Done()
+				rollout := rolloutTarget
+				if target.Rollout != nil {
+					rollout = target.Rollout
+				}
+				tr.Wave = wave
+				tr.Result = &operation.Result{}
+				begin := time.Now()
+				tr.Err = rollout(target.Context, name, spec, append(slices.Clone(fos.options), WithResult(tr.Result))...)
+				tr.Duration = time.Since(begin)
+				tr.Status = TargetSucceeded
+				if tr.Err != nil {
+					tr.Status = TargetFailed
+				}
+			}(&targets[i], result.Targets[i])
+		}
+		wg.Wait()
+		for _, tr := range result.Targets[start:end] {
+			if tr.Err != nil {
+				failed++
+				rc.Logger().Warnf("fleet rollout of %s failed on %s: %s", name, tr.Target, tr.Err)
+			}
+		}
+		if failed > fos.failureBudget {
+			return result, &FleetError{Failed: result.Failed(), Skipped: len(targets) - end}
+		}
+	}
+	return result, nil
+}
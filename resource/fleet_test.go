@@ -0,0 +1,116 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nextbillion-ai/goreman-util/global"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func fleetTargets(namespaces ...string) []Target {
+	var targets []Target
+	for _, namespace := range namespaces {
+		targets = append(targets, Target{Context: global.NewContext(context.Background(), global.WithNamespace(namespace), global.WithLogLevel(logrus.ErrorLevel))})
+	}
+	return targets
+}
+
+func setupFleetTest(t *testing.T) func() {
+	rolloutTargetOrg := rolloutTarget
+	return func() {
+		rolloutTarget = rolloutTargetOrg
+	}
+}
+
+func TestRolloutFleet(t *testing.T) {
+	defer setupFleetTest(t)()
+	var lock sync.Mutex
+	var rolledOut []string
+	rolloutTarget = func(rc global.ResourceContext, name string, spec *global.Spec, options ...ResourceOption) error {
+		lock.Lock()
+		defer lock.Unlock()
+		rolledOut = append(rolledOut, rc.Namespace())
+		ros := &resourceOptions{}
+		for _, option := range options {
+			option(ros)
+		}
+		ros.result.RolloutID = rc.Namespace()
+		return nil
+	}
+	rc := global.NewContext(context.Background(), global.WithLogLevel(logrus.ErrorLevel))
+	result, err := RolloutFleet(rc, "app", &global.Spec{}, fleetTargets("a", "b", "c", "d", "e"), WithBatchSize(2), WithPause(time.Millisecond))
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a", "b", "c", "d", "e"}, rolledOut)
+	for i, tr := range result.Targets {
+		assert.Equal(t, TargetSucceeded, tr.Status)
+		assert.Equal(t, i/2+1, tr.Wave)
+		assert.Equal(t, tr.Target, tr.Result.RolloutID)
+	}
+	assert.Empty(t, result.Failed())
+
+	_, err = RolloutFleet(rc, "app", &global.Spec{}, fleetTargets("a"), WithBatchSize(0))
+	assert.Error(t, err)
+}
+
+func TestRolloutFleetFailureBudget(t *testing.T) {
+	defer setupFleetTest(t)()
+	var lock sync.Mutex
+	var rolledOut []string
+	rolloutTarget = func(rc global.ResourceContext, name string, spec *global.Spec, options ...ResourceOption) error {
+		lock.Lock()
+		defer lock.Unlock()
+		rolledOut = append(rolledOut, rc.Namespace())
+		if rc.Namespace() == "b" || rc.Namespace() == "d" {
+			return errors.New("boom")
+		}
+		return nil
+	}
+	rc := global.NewContext(context.Background(), global.WithLogLevel(logrus.ErrorLevel))
+	result, err := RolloutFleet(rc, "app", &global.Spec{}, fleetTargets("a", "b", "c", "d", "e", "f"), WithBatchSize(2), WithFailureBudget(1))
+	var fleetErr *FleetError
+	assert.True(t, errors.As(err, &fleetErr))
+	assert.Equal(t, 2, fleetErr.Skipped)
+	assert.Len(t, fleetErr.Failed, 2)
+	assert.ElementsMatch(t, []string{"a", "b", "c", "d"}, rolledOut)
+	var statuses []string
+	for _, tr := range result.Targets {
+		statuses = append(statuses, tr.Status)
+	}
+	assert.Equal(t, []string{TargetSucceeded, TargetFailed, TargetSucceeded, TargetFailed, TargetSkipped, TargetSkipped}, statuses)
+	assert.Equal(t, 0, result.Targets[5].Wave)
+
+	rolledOut = nil
+	targets := fleetTargets("a", "b")
+	targets[1].Name = "remote/b"
+	targets[1].Rollout = func(rc global.ResourceContext, name string, spec *global.Spec, options ...ResourceOption) error {
+		return nil
+	}
+	result, err = RolloutFleet(rc, "app", &global.Spec{}, targets)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, rolledOut)
+	assert.Equal(t, "remote/b", result.Targets[1].Target)
+}
+
+func TestRolloutFleetCancel(t *testing.T) {
+	defer setupFleetTest(t)()
+	var rolledOut []string
+	rolloutTarget = func(rc global.ResourceContext, name string, spec *global.Spec, options ...ResourceOption) error {
+		rolledOut = append(rolledOut, rc.Namespace())
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	rc := global.NewContext(ctx, global.WithLogLevel(logrus.ErrorLevel))
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	result, err := RolloutFleet(rc, "app", &global.Spec{}, fleetTargets("a", "b"), WithPause(time.Minute))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []string{"a"}, rolledOut)
+	assert.Equal(t, TargetSkipped, result.Targets[1].Status)
+}
@@ -0,0 +1,220 @@
+package resource
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nextbillion-ai/goreman-util/global"
+	"github.com/nextbillion-ai/goreman-util/operation"
+)
+
+// DefaultWorkers is how many resources RolloutAll rolls out at once when no worker limit is set.
+const DefaultWorkers = 4
+
+// Status of a resource in RolloutAll.
+const (
+	RolloutSucceeded = "succeeded"
+	RolloutFailed    = "failed"
+	RolloutSkipped   = "skipped"
+)
+
+// ResourceResult is the outcome of the rollout of a resource by RolloutAll.
+//
+// Fields:
+// Name: The name of the resource.
+// Status: RolloutSucceeded, RolloutFailed or RolloutSkipped when a dependency did not succeed or
+// the context was cancelled first.
+// Err: Why the rollout failed or was skipped.
+// Result: What the rollout did, see WithResult.
+// Duration: How long the rollout took.
+type ResourceResult struct {
+	Name     string
+	Status   string
+	Err      error
+	Result   *operation.Result
+	Duration time.Duration
+}
+
+// RolloutAllResult is the outcome of RolloutAll, with a result per resource in the order of the
+// resources.
+type RolloutAllResult struct {
+	Resources []*ResourceResult
+}
+
+// Get returns the result of the named resource, nil if it was not rolled out.
+func (a *RolloutAllResult) Get(name string) *ResourceResult {
+	for _, r := range a.Resources {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// RolloutAllError is returned by RolloutAll when resources failed or were skipped.
+type RolloutAllError struct {
+	Failed  []*ResourceResult
+	Skipped []*ResourceResult
+}
+
+func (e *RolloutAllError) Error() string {
+	var failed []string
+	for _, r := range e.Failed {
+		failed = append(failed, fmt.Sprintf("%s: %s", r.Name, r.Err))
+	}
+	return fmt.Sprintf("%d resource(s) failed, %d skipped: %s", len(e.Failed), len(e.Skipped), strings.Join(failed, "; "))
+}
+
+type rolloutAllOptions struct {
+	workers int
+	options []ResourceOption
+}
+
+type RolloutAllOption func(*rolloutAllOptions)
+
+// WithWorkers sets how many resources are rolled out at once, DefaultWorkers by default.
+func WithWorkers(workers int) RolloutAllOption {
+	return func(ros *rolloutAllOptions) {
+		ros.workers = workers
+	}
+}
+
+// WithRolloutOptions sets the options of the rollout of every resource. WithResult is ignored, the
+// result of every resource is in its ResourceResult.
+func WithRolloutOptions(options ...ResourceOption) RolloutAllOption {
+	return func(ros *rolloutAllOptions) {
+		ros.options = options
+	}
+}
+
+var rolloutResource = func(rc global.ResourceContext, r *Resource, options ...ResourceOption) error {
+	return r.Rollout(rc, options...)
+}
+
+// checkDependencies checks that resources have unique names and that their dependencies are
+// resources of the list without cycles.
+func checkDependencies(resources []*Resource) error {
+	byName := map[string]*Resource{}
+	for _, r := range resources {
+		if _, ok := byName[r.Name]; ok {
+			return fmt.Errorf("duplicate resource: %s", r.Name)
+		}
+		byName[r.Name] = r
+	}
+	for _, r := range resources {
+		for _, dependency := range r.DependsOn {
+			if _, ok := byName[dependency]; !ok {
+				return fmt.Errorf("resource %s depends on unknown resource %s", r.Name, dependency)
+			}
+		}
+	}
+	const visiting, visited = 1, 2
+	state := map[string]int{}
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("dependency cycle: %s", strings.Join(append(path, name), " -> "))
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, dependency := range byName[name].DependsOn {
+			if err := visit(dependency, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	for _, r := range resources {
+		if err := visit(r.Name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RolloutAll rolls out resources in parallel, at most the worker limit at once. A resource is
+// rolled out once the resources it depends on (see Resource.DependsOn) succeeded, and skipped if one
+// of them did not. Cancelling the context of rc skips the rollouts not started yet. When resources
+// failed or were skipped, a *RolloutAllError is returned along with the result.
+func RolloutAll(rc global.ResourceContext, resources []*Resource, options ...RolloutAllOption) (*RolloutAllResult, error) {
+	ros := &rolloutAllOptions{workers: DefaultWorkers}
+	for _, option := range options {
+		option(ros)
+	}
+	if ros.workers < 1 {
+		return nil, fmt.Errorf("invalid worker limit: %d", ros.workers)
+	}
+	if err := checkDependencies(resources); err != nil {
+		return nil, err
+	}
+	result := &RolloutAllResult{}
+	done := map[string]chan struct{}{}
+	results := map[string]*ResourceResult{}
+	for _, r := range resources {
+		rr := &ResourceResult{Name: r.Name, Status: RolloutSkipped}
+		result.Resources = append(result.Resources, rr)
+		results[r.Name] = rr
+		done[r.Name] = make(chan struct{})
+	}
+	workers := make(chan struct{}, ros.workers)
+	var wg sync.WaitGroup
+	for _, r := range resources {
+		wg.Add(1)
+		go func(r *Resource, rr *ResourceResult) {
+			defer wg.Done()
+			defer close(done[r.Name])
+			for _, dependency := range r.DependsOn {
+				select {
+				case <-done[dependency]:
+				case <-rc.Context().Done():
+					rr.Err = rc.Context().Err()
+					return
+				}
+				if status := results[dependency].Status; status != RolloutSucceeded {
+					rr.Err = fmt.Errorf("dependency %s %s", dependency, status)
+					return
+				}
+			}
+			select {
+			case workers <- struct{}{}:
+			case <-rc.Context().Done():
+				rr.Err = rc.Context().Err()
+				return
+			}
+			defer func() { <-workers }()
+			if rr.Err = rc.Context().Err(); rr.Err != nil {
+				return
+			}
+			rc.Logger().Infof("rolling out %s", r.Name)
+			rr.Result = &operation.Result{}
+			begin := time.Now()
+			rr.Err = rolloutResource(rc, r, append(slices.Clone(ros.options), WithResult(rr.Result))...)
+			rr.Duration = time.Since(begin)
+			rr.Status = RolloutSucceeded
+			if rr.Err != nil {
+				rr.Status = RolloutFailed
+				rc.Logger().Warnf("rollout of %s failed: %s", r.Name, rr.Err)
+			}
+		}(r, results[r.Name])
+	}
+	wg.Wait()
+	rae := &RolloutAllError{}
+	for _, rr := range result.Resources {
+		switch rr.Status {
+		case RolloutFailed:
+			rae.Failed = append(rae.Failed, rr)
+		case RolloutSkipped:
+			rae.Skipped = append(rae.Skipped, rr)
+		}
+	}
+	if len(rae.Failed) > 0 || len(rae.Skipped) > 0 {
+		return result, rae
+	}
+	return result, nil
+}
@@ -0,0 +1,133 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nextbillion-ai/goreman-util/global"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupParallelTest(t *testing.T) func() {
+	rolloutResourceOrg := rolloutResource
+	return func() {
+		rolloutResource = rolloutResourceOrg
+	}
+}
+
+func TestRolloutAll(t *testing.T) {
+	defer setupParallelTest(t)()
+	var lock sync.Mutex
+	var order []string
+	running, peak := 0, 0
+	rolloutResource = func(rc global.ResourceContext, r *Resource, options ...ResourceOption) error {
+		lock.Lock()
+		running++
+		peak = max(peak, running)
+		lock.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		lock.Lock()
+		running--
+		order = append(order, r.Name)
+		lock.Unlock()
+		ros := &resourceOptions{}
+		for _, option := range options {
+			option(ros)
+		}
+		ros.result.RolloutID = r.Name
+		return nil
+	}
+	rc := global.NewContext(context.Background(), global.WithLogLevel(logrus.ErrorLevel))
+	resources := []*Resource{
+		{Name: "api", DependsOn: []string{"db", "cache"}},
+		{Name: "db"},
+		{Name: "cache"},
+		{Name: "worker", DependsOn: []string{"db"}},
+		{Name: "web", DependsOn: []string{"api"}},
+	}
+	result, err := RolloutAll(rc, resources, WithWorkers(2))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, peak)
+	assert.Len(t, order, 5)
+	index := map[string]int{}
+	for i, name := range order {
+		index[name] = i
+	}
+	assert.Less(t, index["db"], index["api"])
+	assert.Less(t, index["cache"], index["api"])
+	assert.Less(t, index["db"], index["worker"])
+	assert.Less(t, index["api"], index["web"])
+	for _, rr := range result.Resources {
+		assert.Equal(t, RolloutSucceeded, rr.Status)
+		assert.Equal(t, rr.Name, rr.Result.RolloutID)
+	}
+	assert.Equal(t, "web", result.Get("web").Name)
+	assert.Nil(t, result.Get("ghost"))
+}
+
+func TestRolloutAllFailure(t *testing.T) {
+	defer setupParallelTest(t)()
+	var lock sync.Mutex
+	var order []string
+	rolloutResource = func(rc global.ResourceContext, r *Resource, options ...ResourceOption) error {
+		lock.Lock()
+		defer lock.Unlock()
+		order = append(order, r.Name)
+		if r.Name == "db" {
+			return errors.New("boom")
+		}
+		return nil
+	}
+	rc := global.NewContext(context.Background(), global.WithLogLevel(logrus.ErrorLevel))
+	resources := []*Resource{
+		{Name: "api", DependsOn: []string{"db"}},
+		{Name: "db"},
+		{Name: "web", DependsOn: []string{"api"}},
+		{Name: "cache"},
+	}
+	result, err := RolloutAll(rc, resources)
+	var rae *RolloutAllError
+	assert.True(t, errors.As(err, &rae))
+	assert.Len(t, rae.Failed, 1)
+	assert.Len(t, rae.Skipped, 2)
+	assert.ElementsMatch(t, []string{"db", "cache"}, order)
+	assert.Equal(t, RolloutFailed, result.Get("db").Status)
+	assert.Equal(t, RolloutSkipped, result.Get("api").Status)
+	assert.ErrorContains(t, result.Get("api").Err, "dependency db failed")
+	assert.ErrorContains(t, result.Get("web").Err, "dependency api skipped")
+	assert.Equal(t, RolloutSucceeded, result.Get("cache").Status)
+}
+
+func TestRolloutAllInvalid(t *testing.T) {
+	rc := global.NewContext(context.Background(), global.WithLogLevel(logrus.ErrorLevel))
+	_, err := RolloutAll(rc, []*Resource{{Name: "a", DependsOn: []string{"b"}}, {Name: "b", DependsOn: []string{"a"}}})
+	assert.ErrorContains(t, err, "dependency cycle: a -> b -> a")
+	_, err = RolloutAll(rc, []*Resource{{Name: "a", DependsOn: []string{"b"}}})
+	assert.ErrorContains(t, err, "unknown resource b")
+	_, err = RolloutAll(rc, []*Resource{{Name: "a"}, {Name: "a"}})
+	assert.ErrorContains(t, err, "duplicate resource")
+	_, err = RolloutAll(rc, []*Resource{{Name: "a"}}, WithWorkers(0))
+	assert.Error(t, err)
+}
+
+func TestRolloutAllCancel(t *testing.T) {
+	defer setupParallelTest(t)()
+	var order []string
+	rolloutResource = func(rc global.ResourceContext, r *Resource, options ...ResourceOption) error {
+		order = append(order, r.Name)
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rc := global.NewContext(ctx, global.WithLogLevel(logrus.ErrorLevel))
+	result, err := RolloutAll(rc, []*Resource{{Name: "a"}, {Name: "b", DependsOn: []string{"a"}}})
+	var rae *RolloutAllError
+	assert.True(t, errors.As(err, &rae))
+	assert.Len(t, rae.Skipped, 2)
+	assert.Empty(t, order)
+	assert.ErrorIs(t, result.Get("a").Err, context.Canceled)
+}
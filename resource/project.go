@@ -0,0 +1,32 @@
+package resource
+
+import (
+	"fmt"
+
+	"github.com/nextbillion-ai/goreman-util/global"
+)
+
+// FromProject creates a Resource for every resource declared in the project,
+// resolved for the given environment (an empty env uses the base specs).
+// The resources are returned in name order and are ready for Rollout, with the dependencies declared
+// by the project for RolloutAll.
+func FromProject(rc global.ResourceContext, project *global.Project, env string) ([]*Resource, error) {
+	if project == nil {
+		return nil, fmt.Errorf("empty project")
+	}
+	var err error
+	var specs map[string]*global.Spec
+	if specs, err = project.Specs(env); err != nil {
+		return nil, err
+	}
+	var resources []*Resource
+	for _, name := range project.Names() {
+		var r *Resource
+		if r, err = New(rc, name, specs[name]); err != nil {
+			return nil, fmt.Errorf("failed to create resource %s: %w", name, err)
+		}
+		r.DependsOn = project.DependsOn[name]
+		resources = append(resources, r)
+	}
+	return resources, nil
+}
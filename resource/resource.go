@@ -11,6 +11,9 @@
 package resource
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"time"
@@ -27,6 +30,8 @@ type Resource struct {
 	Spec  *global.Spec
 	Asset *asset.Asset
 	Url   string
+	// DependsOn names the resources RolloutAll rolls out before this one.
+	DependsOn []string
 }
 
 // New creates a new Resource instance with the given resource context, name, and spec.
@@ -64,8 +69,21 @@ func (r *Resource) getLockObject() (*lock.Distributed, error) {
 }
 
 type resourceOptions struct {
-	values map[string]any
-	wait   time.Duration
+	values         map[string]any
+	wait           time.Duration
+	fix            bool
+	fieldManager   string
+	forceConflicts bool
+	neverPrune     []string
+	neverPruneSet  bool
+	confirmPrune   func(operation.Orphan) bool
+	result         *operation.Result
+	strictRemoval  bool
+	blueGreen      bool
+	grace          time.Duration
+	dryRun         bool
+	canaryPercent  int
+	canaryCheck    operation.CanaryCheck
 }
 
 type ResourceOption func(*resourceOptions)
@@ -86,6 +104,139 @@ func WithWait(wait time.Duration) ResourceOption {
 	}
 }
 
+// WithFixDrift makes DetectDrift re-apply the recorded manifest to the objects that drifted.
+func WithFixDrift() ResourceOption {
+	return func(ros *resourceOptions) {
+		ros.fix = true
+	}
+}
+
+// WithServerSideApply makes Rollout use server-side apply as fieldManager, see operation.WithServerSideApply.
+func WithServerSideApply(fieldManager string) ResourceOption {
+	return func(ros *resourceOptions) {
+		if fieldManager == "" {
+			fieldManager = operation.DefaultFieldManager
+		}
+		ros.fieldManager = fieldManager
+	}
+}
+
+// WithForceConflicts makes server-side apply take over fields owned by other managers.
+func WithForceConflicts() ResourceOption {
+	return func(ros *resourceOptions) {
+		ros.forceConflicts = true
+	}
+}
+
+// WithNeverPruneKinds replaces the kinds Rollout never deletes when they are removed from the chart,
+// see operation.DefaultNeverPruneKinds.
+func WithNeverPruneKinds(kinds ...string) ResourceOption {
+	return func(ros *resourceOptions) {
+		ros.neverPrune = kinds
+		ros.neverPruneSet = true
+	}
+}
+
+// WithPruneConfirmation makes Rollout ask confirm before deleting objects removed from the chart.
+func WithPruneConfirmation(confirm func(operation.Orphan) bool) ResourceOption {
+	return func(ros *resourceOptions) {
+		ros.confirmPrune = confirm
+	}
+}
+
+// WithStrictRemoval makes Rollout fail when objects could not be deleted, see
+// operation.WithStrictRemoval. Uninstall, ForceRotate, GCRotations, Promote and Abort always do.
+func WithStrictRemoval() ResourceOption {
+	return func(ros *resourceOptions) {
+		ros.strictRemoval = true
+	}
+}
+
+// WithBlueGreen makes StatefulSet rotations blue/green, keeping the previous rotation for grace or
+// until Promote when grace is 0, see operation.WithBlueGreen.
+func WithBlueGreen(grace time.Duration) ResourceOption {
+	return func(ros *resourceOptions) {
+		ros.blueGreen = true
+		ros.grace = grace
+	}
+}
+
+// WithCanary makes Rollout update changed Deployments through a `<name>-canary` copy running
+// percent of their replicas, gated by its readiness and check if not nil, see operation.WithCanary.
+func WithCanary(percent int, check operation.CanaryCheck) ResourceOption {
+	return func(ros *resourceOptions) {
+		ros.canaryPercent = percent
+		ros.canaryCheck = check
+	}
+}
+
+// WithDryRun makes ForceRotate and GCRotations only report what they would do.
+func WithDryRun() ResourceOption {
+	return func(ros *resourceOptions) {
+		ros.dryRun = true
+	}
+}
+
+// WithResult makes Rollout, Uninstall, ForceRotate, GCRotations, Promote and Abort fill result
+// with what they did.
+func WithResult(result *operation.Result) ResourceOption {
+	return func(ros *resourceOptions) {
+		ros.result = result
+	}
+}
+
+// valuesHash returns a stable hash of the app values, json encoding sorts map keys.
+func valuesHash(app map[string]any) (string, error) {
+	data, err := json.Marshal(app)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// values renders the values the chart of the resource is rolled out with at ts and validates the
+// app values against the asset schema.
+func (r *Resource) values(rc global.ResourceContext, ros *resourceOptions, ts int64) (values, app map[string]any, err error) {
+	var g map[string]any
+	if g, err = global.GlobalSpec(rc, r.Name, r.Spec.App); err != nil {
+		return
+	}
+	g = raw.Merge(g, map[string]any{
+		"name":       r.Name,
+		"namespace":  rc.Namespace(),
+		"cluster":    global.MustHaveOptions().Cluster,
+		"ts":         ts,
+		"deployTime": strconv.FormatInt(ts, 10),
+	})
+	app = raw.Merge(r.Spec.App, ros.values)
+	if app, err = global.ExpandValues(app, global.TemplateScope(rc, g)); err != nil {
+		return
+	}
+	values = map[string]any{"app": app, "global": g}
+	//fmt.Printf("%+v\n", values)
+	err = r.Asset.Validate(app)
+	return
+}
+
+// Plan returns, without changing anything, whether and why every StatefulSet of the resource would
+// be rotated by Rollout with the same options.
+func (r *Resource) Plan(rc global.ResourceContext, options ...ResourceOption) ([]*operation.RotationDecision, error) {
+	ros := &resourceOptions{}
+	for _, option := range options {
+		option(ros)
+	}
+	values, _, err := r.values(rc, ros, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	oos := []operation.OperationOption{}
+	if policy := r.Asset.Metadata().Rotation; policy != nil {
+		oos = append(oos, operation.WithRotationPolicy(policy.Over(global.RotationPolicyOf(rc))))
+	}
+	return operation.Plan(rc, r.Asset.ChartPath(), values, oos...)
+}
+
 // Rollout performs a resource rollout operation.
 // It acquires a lock, merges global and app-specific options, validates the asset,
 // and then triggers the rollout operation using the provided resource context and options.
@@ -104,28 +255,52 @@ func (r *Resource) Rollout(rc global.ResourceContext, options ...ResourceOption)
 	for _, option := range options {
 		option(ros)
 	}
-	var g map[string]any
-	if g, err = global.GlobalSpec(rc, r.Name, r.Spec.App); err != nil {
+	ts := time.Now().Unix()
+	var values, app map[string]any
+	if values, app, err = r.values(rc, ros, ts); err != nil {
 		return err
 	}
-	ts := time.Now().Unix()
-	g = raw.Merge(g, map[string]any{
-		"name":       r.Name,
-		"namespace":  rc.Namespace(),
-		"cluster":    global.MustHaveOptions().Cluster,
-		"ts":         ts,
-		"deployTime": strconv.FormatInt(ts, 10),
-	})
-	app := raw.Merge(r.Spec.App, ros.values)
-	values := map[string]any{"app": app, "global": g}
-	//fmt.Printf("%+v\n", values)
-	if err = r.Asset.Validate(app); err != nil {
+	var hash string
+	if hash, err = valuesHash(app); err != nil {
 		return err
 	}
-	oos := []operation.OperationOption{}
+	oos := []operation.OperationOption{operation.WithRecord(&operation.Record{
+		AssetType:    r.Spec.Asset.Typ,
+		AssetRelease: r.Spec.Asset.Release,
+		ValuesHash:   hash,
+		DeployTime:   time.Unix(ts, 0),
+	})}
 	if ros.wait > 0 {
 		oos = append(oos, operation.WithWait(ros.wait))
 	}
+	// the rotation policy of the asset is specific to its chart, its fields win over those of rc
+	if policy := r.Asset.Metadata().Rotation; policy != nil {
+		oos = append(oos, operation.WithRotationPolicy(policy.Over(global.RotationPolicyOf(rc))))
+	}
+	if ros.fieldManager != "" {
+		oos = append(oos, operation.WithServerSideApply(ros.fieldManager))
+	}
+	if ros.forceConflicts {
+		oos = append(oos, operation.WithForceConflicts())
+	}
+	if ros.neverPruneSet {
+		oos = append(oos, operation.WithNeverPruneKinds(ros.neverPrune...))
+	}
+	if ros.confirmPrune != nil {
+		oos = append(oos, operation.WithPruneConfirmation(ros.confirmPrune))
+	}
+	if ros.result != nil {
+		oos = append(oos, operation.WithResult(ros.result))
+	}
+	if ros.strictRemoval {
+		oos = append(oos, operation.WithStrictRemoval())
+	}
+	if ros.blueGreen {
+		oos = append(oos, operation.WithBlueGreen(ros.grace))
+	}
+	if ros.canaryPercent != 0 {
+		oos = append(oos, operation.WithCanary(ros.canaryPercent, ros.canaryCheck))
+	}
 	return operation.Rollout(rc, r.Asset.ChartPath(), values, oos...)
 }
 
@@ -143,5 +318,84 @@ func Uninstall(rc global.ResourceContext, name string, options ...ResourceOption
 	if ros.wait > 0 {
 		oos = append(oos, operation.WithWait(ros.wait))
 	}
+	if ros.result != nil {
+		oos = append(oos, operation.WithResult(ros.result))
+	}
 	return operation.Remove(rc, name, rc.Namespace(), oos...)
 }
+
+// DetectDrift reports the objects of the named resource whose live state no longer matches the
+// manifest recorded by the last rollout. With WithFixDrift, drifted objects are re-applied.
+func DetectDrift(rc global.ResourceContext, name string, options ...ResourceOption) (*operation.DriftReport, error) {
+	ros := &resourceOptions{}
+	for _, option := range options {
+		option(ros)
+	}
+	oos := []operation.OperationOption{}
+	if ros.fix {
+		oos = append(oos, operation.WithFix())
+	}
+	return operation.DetectDrift(rc, name, oos...)
+}
+
+// Status describes what is deployed for the named resource: the asset and values hash of the last
+// rollout, its deploy time, the current StatefulSet rotations and the readiness of every workload.
+func Status(rc global.ResourceContext, name string) (*operation.ResourceStatus, error) {
+	return operation.Status(rc, name)
+}
+
+// List returns every resource managed by goreman-util in the namespace of rc (all namespaces if rc
+// has no namespace) matching the label selector, with its asset, release, last deploy time and health.
+func List(rc global.ResourceContext, selector string) ([]*operation.Summary, error) {
+	return operation.List(rc, selector)
+}
+
+// Promote removes the rotations kept by the blue/green rollout of the named resource.
+func Promote(rc global.ResourceContext, name string, options ...ResourceOption) error {
+	return operation.Promote(rc, name, rotationOptions(options)...)
+}
+
+// Abort switches the traffic of the named resource back to the rotations kept by its blue/green
+// rollout and removes the new rotations.
+func Abort(rc global.ResourceContext, name string, options ...ResourceOption) error {
+	return operation.Abort(rc, name, rotationOptions(options)...)
+}
+
+// rotationOptions returns the operation options of ForceRotate, GCRotations, Promote and Abort.
+func rotationOptions(options []ResourceOption) []operation.OperationOption {
+	ros := &resourceOptions{}
+	for _, option := range options {
+		option(ros)
+	}
+	oos := []operation.OperationOption{}
+	if ros.wait > 0 {
+		oos = append(oos, operation.WithWait(ros.wait))
+	}
+	if ros.fieldManager != "" {
+		oos = append(oos, operation.WithServerSideApply(ros.fieldManager))
+	}
+	if ros.forceConflicts {
+		oos = append(oos, operation.WithForceConflicts())
+	}
+	if ros.result != nil {
+		oos = append(oos, operation.WithResult(ros.result))
+	}
+	if ros.strictRemoval {
+		oos = append(oos, operation.WithStrictRemoval())
+	}
+	if ros.dryRun {
+		oos = append(oos, operation.WithDryRun())
+	}
+	return oos
+}
+
+// ForceRotate replaces the StatefulSet sts of the named resource with a new rotation and removes the
+// previous ones, see operation.ForceRotate.
+func ForceRotate(rc global.ResourceContext, name, sts string, options ...ResourceOption) (*operation.RotationChange, error) {
+	return operation.ForceRotate(rc, name, sts, rotationOptions(options)...)
+}
+
+// GCRotations removes every rotation but the current one of the StatefulSets of the named resource.
+func GCRotations(rc global.ResourceContext, name string, options ...ResourceOption) ([]*operation.RotationChange, error) {
+	return operation.GCRotations(rc, name, rotationOptions(options)...)
+}